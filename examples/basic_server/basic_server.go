@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"log/slog"
 	"os"
 
 	"github.com/kward/go-osc/osc"
@@ -10,7 +11,8 @@ import (
 
 func main() {
 	addr := "127.0.0.1:8000"
-	server, err := osc.NewServer(addr)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	server, err := osc.NewServer(addr, osc.ServerLogger(logger))
 	if err != nil {
 		fmt.Println("Error creating server:", err)
 		os.Exit(1)
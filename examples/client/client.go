@@ -42,7 +42,9 @@ func main() {
 			message.Append("teststring")
 			message.Append(true)
 			message.Append(false)
-			client.Send(message)
+			if err := client.Send(message); err != nil {
+				fmt.Println("Error sending message:", err)
+			}
 		} else if sline == "b" {
 			bundle := osc.NewBundle(time.Now())
 			message1 := osc.NewMessage("/bundle/message/1")
@@ -56,9 +58,15 @@ func main() {
 			message2.Append("string1")
 			message2.Append("string2")
 			message2.Append(true)
-			bundle.Append(message1)
-			bundle.Append(message2)
-			client.Send(bundle)
+			if err := bundle.Append(message1); err != nil {
+				fmt.Println("Error adding message to bundle:", err)
+			}
+			if err := bundle.Append(message2); err != nil {
+				fmt.Println("Error adding message to bundle:", err)
+			}
+			if err := client.Send(bundle); err != nil {
+				fmt.Println("Error sending bundle:", err)
+			}
 		} else if sline == "q" {
 			fmt.Println("Exit!")
 			os.Exit(0)
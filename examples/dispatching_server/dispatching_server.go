@@ -13,9 +13,14 @@ func main() {
 		panic(err)
 	}
 
-	server.Handle("/message/address", func(msg *osc.Message) {
+	err = server.Handle("/message/address", func(msg *osc.Message) {
 		fmt.Println(msg)
 	})
+	if err != nil {
+		panic(err)
+	}
 
-	server.ListenAndServe()
+	if err := server.ListenAndServe(); err != nil {
+		panic(err)
+	}
 }
@@ -0,0 +1,229 @@
+package osc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBatcherClosed is returned by Batcher.Send after a call to Close.
+var ErrBatcherClosed = errors.New("batcher closed")
+
+// Batcher collects the packets sent through it and sends them on as bundles
+// with an immediate timetag, which is much cheaper than sending many small
+// datagrams, for example when moving 64 faders at once. A bundle is sent when
+// the batching window has passed since its first packet, when adding another
+// packet would exceed the size limit, on Flush and on Close. Packets keep
+// their order.
+type Batcher struct {
+	sender Sender
+	opts   *batcherOptions
+
+	mu      sync.Mutex
+	pending []Packet
+	data    [][]byte // Encoded pending packets.
+	size    int      // Encoded size of the pending bundle.
+	timer   Timer
+	closed  bool
+}
+
+// Verify that interfaces are implemented properly.
+var _ Sender = (*Batcher)(nil)
+
+type batcherOptions struct {
+	window  time.Duration
+	maxSize int
+	onError func(err error)
+	clock   Clock
+}
+
+// BatcherWindow sets how long a Batcher collects packets before sending them.
+// The window starts with the first packet of a bundle. Zero disables the
+// window, so bundles are only sent when full and on Flush. The default is 5ms.
+func BatcherWindow(v time.Duration) func(*batcherOptions) error {
+	return func(o *batcherOptions) error { return o.setWindow(v) }
+}
+
+func (o *batcherOptions) setWindow(v time.Duration) error {
+	if v < 0 {
+		return fmt.Errorf("negative window: %s", v)
+	}
+	o.window = v
+	return nil
+}
+
+// BatcherMaxSize sets the maximum encoded size of a bundle. Packets that do
+// not fit in the current bundle start a new one. The default of 1472 bytes
+// fits a bundle in a single Ethernet frame.
+func BatcherMaxSize(v int) func(*batcherOptions) error {
+	return func(o *batcherOptions) error { return o.setMaxSize(v) }
+}
+
+func (o *batcherOptions) setMaxSize(v int) error {
+	if v <= bundleHeaderSize {
+		return fmt.Errorf("max size too small: %d", v)
+	}
+	o.maxSize = v
+	return nil
+}
+
+// BatcherOnError sets a function that is called with the errors of bundles
+// sent when the batching window has passed, which have no caller to return
+// them to.
+func BatcherOnError(v func(err error)) func(*batcherOptions) error {
+	return func(o *batcherOptions) error { return o.setOnError(v) }
+}
+
+func (o *batcherOptions) setOnError(v func(err error)) error {
+	o.onError = v
+	return nil
+}
+
+// BatcherClock sets the clock that times the batching window. The default is
+// SystemClock.
+func BatcherClock(v Clock) func(*batcherOptions) error {
+	return func(o *batcherOptions) error { return o.setClock(v) }
+}
+
+func (o *batcherOptions) setClock(v Clock) error {
+	if v == nil {
+		return errors.New("nil clock")
+	}
+	o.clock = v
+	return nil
+}
+
+// NewBatcher returns a Batcher that sends bundles through `s`. The Batcher
+// does not take ownership of `s`.
+func NewBatcher(s Sender, opts ...func(*batcherOptions) error) (*Batcher, error) {
+	o := &batcherOptions{window: 5 * time.Millisecond, maxSize: 1472, clock: SystemClock}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return &Batcher{sender: s, opts: o}, nil
+}
+
+// Send adds the Packet `pkt` to the current bundle. Errors of bundles sent
+// because the current bundle is full are returned by Send. A packet that is
+// too large for any bundle is sent on its own.
+func (b *Batcher) Send(pkt Packet) error {
+	data, err := pkt.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBatcherClosed
+	}
+
+	elemSize := 4 + len(data)
+	if bundleHeaderSize+elemSize > b.opts.maxSize {
+		if err := b.flush(); err != nil {
+			return err
+		}
+		return b.sendData(pkt, data)
+	}
+	var ferr error
+	if b.size+b.runSize(pkt)+elemSize > b.opts.maxSize {
+		ferr = b.flush()
+	}
+	if len(b.pending) == 0 {
+		b.size = bundleHeaderSize
+		b.startTimer()
+	}
+	b.size += b.runSize(pkt) + elemSize
+	b.pending = append(b.pending, pkt)
+	b.data = append(b.data, data)
+	return ferr
+}
+
+// runSize returns the size that `pkt` adds to the pending bundle besides its
+// own: a message that follows a nested bundle is enclosed in a bundle of its
+// own, see bundleOf, unless the sender is sent the encoded packets. The caller
+// must hold b.mu.
+func (b *Batcher) runSize(pkt Packet) int {
+	if _, ok := b.sender.(dataSender); ok {
+		return 0
+	}
+	if _, ok := pkt.(*Message); !ok || len(b.pending) == 0 {
+		return 0
+	}
+	if _, ok := b.pending[len(b.pending)-1].(*Bundle); !ok {
+		return 0
+	}
+	return 4 + bundleHeaderSize
+}
+
+// Flush sends the current bundle, if any, immediately.
+func (b *Batcher) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flush()
+}
+
+// Close sends the current bundle and stops the Batcher. Packets sent after
+// Close are rejected with ErrBatcherClosed.
+func (b *Batcher) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	return b.flush()
+}
+
+// startTimer starts the batching window of a new bundle. The caller must hold
+// b.mu.
+func (b *Batcher) startTimer() {
+	if b.opts.window == 0 {
+		return
+	}
+	var t Timer
+	t = b.opts.clock.AfterFunc(b.opts.window, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.timer != t {
+			return // The bundle has already been sent.
+		}
+		if err := b.flush(); err != nil && b.opts.onError != nil {
+			b.opts.onError(err)
+		}
+	})
+	b.timer = t
+}
+
+// flush sends the pending packets as a bundle. The caller must hold b.mu.
+func (b *Batcher) flush() error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.pending) == 0 {
+		return nil
+	}
+	pending, encoded := b.pending, b.data
+	b.pending, b.data, b.size = nil, nil, 0
+
+	if _, ok := b.sender.(dataSender); !ok {
+		return b.sender.Send(bundleOf(Immediate, pending))
+	}
+
+	// Encode the bundle from the encoded packets, which also keeps messages
+	// and nested bundles in the order they were sent.
+	return b.sender.(dataSender).sendData(context.Background(), encodeBundle(Immediate, encoded))
+}
+
+// sendData sends the encoded packet `data` on its own.
+func (b *Batcher) sendData(pkt Packet, data []byte) error {
+	if ds, ok := b.sender.(dataSender); ok {
+		return ds.sendData(context.Background(), data)
+	}
+	return b.sender.Send(pkt)
+}
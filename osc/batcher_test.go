@@ -0,0 +1,223 @@
+package osc
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// receiveBundles reads bundles from `conn` until it has received `n`
+// messages in total.
+func receiveBundles(t *testing.T, conn net.PacketConn, n int) []*Bundle {
+	t.Helper()
+	var bundles []*Bundle
+	for received := 0; received < n; {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		data := make([]byte, 65535)
+		l, _, err := conn.ReadFrom(data)
+		if err != nil {
+			t.Fatalf("ReadFrom() unexpected error; %s", err)
+		}
+		pkt, err := decodePacket(data[:l])
+		if err != nil {
+			t.Fatalf("decodePacket() unexpected error; %s", err)
+		}
+		b, ok := pkt.(*Bundle)
+		if !ok {
+			t.Fatalf("received %T, want *Bundle", pkt)
+		}
+		bundles = append(bundles, b)
+		received += len(b.Messages)
+	}
+	return bundles
+}
+
+func TestBatcher(t *testing.T) {
+	for _, tt := range []struct {
+		desc    string
+		maxSize int
+		bundles int
+	}{
+		// Each fader message takes 4+20 bytes in a bundle.
+		{"one bundle", 2048, 1},
+		{"split", 16 + 10*24, 7},
+	} {
+		device := listenUDP(t)
+		client, err := Dial("udp", device.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		b, err := NewBatcher(client, BatcherWindow(20*time.Millisecond), BatcherMaxSize(tt.maxSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 64; i++ {
+			if err := b.Send(NewMessage("/fader", int32(i), float32(0.5))); err != nil {
+				t.Fatalf("%s: Send() unexpected error; %s", tt.desc, err)
+			}
+		}
+		bundles := receiveBundles(t, device, 64)
+		if got, want := len(bundles), tt.bundles; got != want {
+			t.Errorf("%s: bundles = %d, want = %d", tt.desc, got, want)
+		}
+		i := int32(0)
+		for _, bundle := range bundles {
+			if got, want := bundle.Timetag, Immediate; got != want {
+				t.Errorf("%s: timetag = %d, want = %d", tt.desc, got, want)
+			}
+			for _, msg := range bundle.Messages {
+				if got, want := msg.Arguments[0], i; got != want {
+					t.Errorf("%s: message %d = %v, want = %v", tt.desc, i, got, want)
+				}
+				i++
+			}
+		}
+	}
+}
+
+func TestBatcherFlushClose(t *testing.T) {
+	device := listenUDP(t)
+	client, err := Dial("udp", device.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	b, err := NewBatcher(client, BatcherWindow(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, flush := range []func() error{b.Flush, b.Close} {
+		for i := 0; i < 3; i++ {
+			if err := b.Send(NewMessage("/fader", int32(i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Without a window, nothing is sent until the bundle is flushed.
+		device.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		if _, _, err := device.ReadFrom(make([]byte, 1024)); err == nil {
+			t.Fatal("received a bundle before it was flushed")
+		}
+		if err := flush(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(receiveBundles(t, device, 3)), 1; got != want {
+			t.Errorf("bundles = %d, want = %d", got, want)
+		}
+	}
+
+	if err := b.Send(NewMessage("/fader")); !errors.Is(err, ErrBatcherClosed) {
+		t.Errorf("Send() after Close() = %v, want %v", err, ErrBatcherClosed)
+	}
+}
+
+func TestBatcherOversize(t *testing.T) {
+	s := &recordingSender{}
+	b, err := NewBatcher(s, BatcherWindow(0), BatcherMaxSize(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	small, large := NewMessage("/small"), NewMessage("/large", string(make([]byte, 64)))
+	for _, msg := range []*Message{small, large, small} {
+		if err := b.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The large message flushes the pending bundle and is sent on its own.
+	if got, want := len(s.pkts), 3; got != want {
+		t.Fatalf("sent %d packets, want = %d", got, want)
+	}
+	if bundle, ok := s.pkts[0].(*Bundle); !ok || bundle.Messages[0] != small {
+		t.Errorf("packet 0 = %v, want bundle of %v", s.pkts[0], small)
+	}
+	if s.pkts[1] != large {
+		t.Errorf("packet 1 = %v, want = %v", s.pkts[1], large)
+	}
+	if bundle, ok := s.pkts[2].(*Bundle); !ok || bundle.Timetag != Immediate {
+		t.Errorf("packet 2 = %v, want immediate bundle", s.pkts[2])
+	}
+}
+
+func TestBatcherOrder(t *testing.T) {
+	s := &recordingSender{}
+	b, err := NewBatcher(s, BatcherWindow(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested := &Bundle{Timetag: Immediate}
+	nested.Append(NewMessage("/b"))
+	for _, pkt := range []Packet{NewMessage("/a"), nested, NewMessage("/c"), NewMessage("/d")} {
+		if err := b.Send(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(s.pkts), 1; got != want {
+		t.Fatalf("sent %d packets, want = %d", got, want)
+	}
+
+	// A receiver dispatches the messages in the order they were sent.
+	var got []string
+	d := NewOSCDispatcher()
+	for _, addr := range []string{"/a", "/b", "/c", "/d"} {
+		if err := d.AddMsgHandler(addr, func(msg *Message) { got = append(got, msg.Address) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Dispatch(s.pkts[0])
+	if want := []string{"/a", "/b", "/c", "/d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dispatched %v, want %v", got, want)
+	}
+}
+
+func TestBatcherMaxSizeOrder(t *testing.T) {
+	nested := &Bundle{Timetag: Immediate}
+	nested.Append(NewMessage("/b"))
+	pkts := []Packet{NewMessage("/a"), nested, NewMessage("/c")}
+	maxSize := bundleHeaderSize
+	for _, pkt := range pkts {
+		data, err := pkt.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		maxSize += 4 + len(data)
+	}
+
+	// The packets fit in a bundle of `maxSize` bytes, but not once /c is
+	// enclosed in a bundle of its own to keep the order.
+	s := &recordingSender{}
+	b, err := NewBatcher(s, BatcherWindow(0), BatcherMaxSize(maxSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkt := range pkts {
+		if err := b.Send(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(s.pkts), 2; got != want {
+		t.Errorf("sent %d packets, want = %d", got, want)
+	}
+	for i, pkt := range s.pkts {
+		data, err := pkt.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > maxSize {
+			t.Errorf("packet %d is %d bytes, want at most %d", i, len(data), maxSize)
+		}
+	}
+}
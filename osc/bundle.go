@@ -11,6 +11,10 @@ import (
 
 const bundleTag = "#bundle"
 
+// bundleHeaderSize is the size of an encoded bundle without elements: the
+// padded "#bundle" string and the timetag.
+const bundleHeaderSize = 16
+
 // Bundle represents an OSC bundle. It consists of the OSC-string "#bundle"
 // followed by an OSC Time Tag, followed by zero or more OSC bundle/message
 // elements. The OSC-timetag is a 64-bit fixed point time tag. See
@@ -28,7 +32,25 @@ var _ Packet = (*Bundle)(nil)
 // NewBundle returns an OSC Bundle. Use this function to create a new OSC
 // Bundle.
 func NewBundle(time time.Time) *Bundle {
-	return &Bundle{Timetag: *NewTimetag(time)}
+	return &Bundle{Timetag: NewTimetag(time)}
+}
+
+// encodeBundle encodes a bundle with the timetag `tt` from the encoded
+// elements `elems`, in order.
+func encodeBundle(tt Timetag, elems [][]byte) []byte {
+	size := bundleHeaderSize
+	for _, e := range elems {
+		size += 4 + len(e)
+	}
+	data := make([]byte, 0, size)
+	data = append(data, bundleTag...)
+	data = append(data, 0)
+	data = binary.BigEndian.AppendUint64(data, uint64(tt))
+	for _, e := range elems {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(e)))
+		data = append(data, e...)
+	}
+	return data
 }
 
 // Addr implements the Packet interface.
@@ -53,6 +75,33 @@ func (b *Bundle) Append(pck Packet) error {
 	return nil
 }
 
+// bundleOf returns a bundle with the time tag `tt` that holds `pkts` in
+// order. As a Bundle keeps its messages apart from its nested bundles, the
+// messages that follow a nested bundle are enclosed in bundles of their own
+// with the same time tag.
+func bundleOf(tt Timetag, pkts []Packet) *Bundle {
+	b := &Bundle{Timetag: tt}
+	var run *Bundle // Bundle of the messages that follow a nested bundle.
+	for _, pkt := range pkts {
+		switch t := pkt.(type) {
+		case *Message:
+			if len(b.Bundles) == 0 {
+				b.Messages = append(b.Messages, t)
+				continue
+			}
+			if run == nil {
+				run = &Bundle{Timetag: tt}
+				b.Bundles = append(b.Bundles, run)
+			}
+			run.Messages = append(run.Messages, t)
+		case *Bundle:
+			b.Bundles = append(b.Bundles, t)
+			run = nil
+		}
+	}
+	return b
+}
+
 // MarshalBinary serializes the OSC bundle to a byte array with the following
 // format:
 // 1. Bundle string: '#bundle'
@@ -138,7 +187,7 @@ func readBundle(reader *bufio.Reader, start *int, end int) (*Bundle, error) {
 	*start += 8
 
 	// Create a new bundle
-	bundle := NewBundle(timetagToTime(timeTag))
+	bundle := &Bundle{Timetag: Timetag(timeTag)}
 
 	// Read until the end of the buffer
 	for *start < end {
@@ -1,16 +1,204 @@
 package osc
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
 )
 
+// Sender is the interface implemented by anything that can send OSC packets.
+type Sender interface {
+	// Send sends the Packet `pkt`.
+	Send(pkt Packet) error
+}
+
+// Verify that interfaces are implemented properly.
+var _ Sender = (*Client)(nil)
+
+type clientOptions struct {
+	framing         Framing
+	localAddr       string
+	resolveInterval time.Duration
+	mtu             int
+	broadcast       bool
+
+	multicastTTL        int
+	noMulticastLoopback bool
+	multicastInterface  string
+
+	clock  Clock
+	logger *slog.Logger
+	tracer Tracer
+}
+
+func newClientOptions(opts []func(*clientOptions) error) (*clientOptions, error) {
+	o := defaultClientOptions()
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+func defaultClientOptions() *clientOptions {
+	return &clientOptions{clock: SystemClock, logger: discardLogger, tracer: nopTracer{}}
+}
+
+// ClientFraming sets the framing used by stream clients. The default is
+// FramingLengthPrefix.
+func ClientFraming(v Framing) func(*clientOptions) error {
+	return func(o *clientOptions) error { return o.setFraming(v) }
+}
+
+func (o *clientOptions) setFraming(v Framing) error {
+	if err := v.validate(); err != nil {
+		return err
+	}
+	o.framing = v
+	return nil
+}
+
+// ClientLocalAddr sets the local address a client created with Dial sends
+// from. For "unixgram" it is the path of the client's own socket file, which
+// is required to receive replies. A stale socket file at the path is removed
+// first, and the file is removed again on Close.
+func ClientLocalAddr(v string) func(*clientOptions) error {
+	return func(o *clientOptions) error { return o.setLocalAddr(v) }
+}
+
+func (o *clientOptions) setLocalAddr(v string) error {
+	o.localAddr = v
+	return nil
+}
+
+// ClientResolveInterval sets how often a client created with Dial resolves
+// its destination address again, for example to follow DNS changes. The
+// default of zero resolves the address once, when dialing.
+func ClientResolveInterval(v time.Duration) func(*clientOptions) error {
+	return func(o *clientOptions) error { return o.setResolveInterval(v) }
+}
+
+func (o *clientOptions) setResolveInterval(v time.Duration) error {
+	if v < 0 {
+		return fmt.Errorf("negative resolve interval: %s", v)
+	}
+	o.resolveInterval = v
+	return nil
+}
+
+// ClientClock sets the clock that keeps time for the client and for the
+// Subscription and ReliableClient built on it, for example a FakeClock in
+// tests. The default is SystemClock.
+func ClientClock(v Clock) func(*clientOptions) error {
+	return func(o *clientOptions) error { return o.setClock(v) }
+}
+
+func (o *clientOptions) setClock(v Clock) error {
+	if v == nil {
+		return errors.New("nil clock")
+	}
+	o.clock = v
+	return nil
+}
+
+// ClientLogger sets the logger for packets received by the client that are
+// dropped, for example because they cannot be decoded, and for panics of
+// handlers. By default, nothing is logged.
+func ClientLogger(v *slog.Logger) func(*clientOptions) error {
+	return func(o *clientOptions) error { return o.setLogger(v) }
+}
+
+func (o *clientOptions) setLogger(v *slog.Logger) error {
+	if v == nil {
+		return errors.New("nil logger")
+	}
+	o.logger = v
+	return nil
+}
+
+// ClientTracer sets the Tracer that records spans of the packets sent with
+// SendContext and of those received by a client created with Dial. If it is a
+// TracePropagator, packets are sent with the trace context of their span, see
+// WithTraceContext, and the trace of received packets is continued.
+func ClientTracer(v Tracer) func(*clientOptions) error {
+	return func(o *clientOptions) error { return o.setTracer(v) }
+}
+
+func (o *clientOptions) setTracer(v Tracer) error {
+	if v == nil {
+		return errors.New("nil tracer")
+	}
+	o.tracer = v
+	return nil
+}
+
+// ClientBroadcast sets whether a client created with Dial may send to
+// broadcast addresses, such as 255.255.255.255 or the broadcast address of a
+// subnet. Broadcast requires IPv4, so a broadcasting "udp" client sends from an
+// IPv4 socket. Use Collect to gather the replies of all responders.
+func ClientBroadcast(v bool) func(*clientOptions) error {
+	return func(o *clientOptions) error { return o.setBroadcast(v) }
+}
+
+func (o *clientOptions) setBroadcast(v bool) error {
+	o.broadcast = v
+	return nil
+}
+
+// ClientMTU sets the path MTU to the destination of a client created with
+// Dial. Packets that do not fit in a single unfragmented IP packet are then
+// rejected with ErrPacketTooLarge instead of being fragmented. The default of
+// zero only rejects packets larger than a UDP datagram.
+func ClientMTU(v int) func(*clientOptions) error {
+	return func(o *clientOptions) error { return o.setMTU(v) }
+}
+
+func (o *clientOptions) setMTU(v int) error {
+	if v != 0 && v < 68 {
+		return fmt.Errorf("MTU too small: %d", v)
+	}
+	o.mtu = v
+	return nil
+}
+
 // Client enables you to send OSC packets. It sends OSC messages and bundles to
-// the given IP address and port.
+// the given IP address and port, or to another datagram address such as a unix
+// socket path.
+//
+// A Client created with NewClient or NewClientAddr dials a new socket for every
+// Send. A Client created with Dial keeps a single socket open until Close, so
+// packets always leave from the same source port. Its methods may be called
+// from several goroutines at once.
 type Client struct {
-	ip    string
-	port  int
-	laddr *net.UDPAddr
+	opts *clientOptions
+
+	mu        sync.Mutex
+	network   string
+	addr      string
+	laddr     *net.UDPAddr
+	conn      net.PacketConn // Connection to send on; nil to dial on every Send.
+	connected bool           // conn is connected to raddr.
+	owned     bool           // conn was opened by Dial and is closed by Close.
+	raddr     net.Addr
+	resolved  time.Time     // Time raddr was last resolved.
+	resolving chan struct{} // Closed when the lookup in flight ends; nil if none.
+	closed    bool
+	watchers  map[*watcher]struct{}
+
+	// writeMu is held for reading by plain writes on conn, and for writing by
+	// writes that set a write deadline on conn.
+	writeMu sync.RWMutex
+
+	recvOnce   sync.Once
+	dispatcher *OSCDispatcher // Handlers for received packets.
 }
 
 // NewClient creates a new OSC client. The Client is used to send OSC
@@ -18,50 +206,593 @@ type Client struct {
 // specifies the IP address and `port` defines the target port where the
 // messages and bundles will be send to.
 func NewClient(ip string, port int) *Client {
-	return &Client{ip: ip, port: port, laddr: nil}
+	return &Client{
+		opts:    defaultClientOptions(),
+		network: "udp",
+		addr:    net.JoinHostPort(ip, strconv.Itoa(port)),
+	}
+}
+
+// NewClientAddr creates a new OSC client that sends OSC packets to the address
+// `addr` on the named datagram network. Supported networks are "udp", "udp4",
+// "udp6" and "unixgram", where the address of the latter is the path of the
+// server's socket file. Use DialStream for stream networks.
+func NewClientAddr(network, addr string) (*Client, error) {
+	if err := checkPacketNetwork(network); err != nil {
+		return nil, err
+	}
+	return &Client{opts: defaultClientOptions(), network: network, addr: addr}, nil
+}
+
+// NewClientConn returns a Client that sends packets to `addr` over the
+// existing connection `conn`, for example a SerialConn. The caller remains
+// responsible for closing `conn`.
+func NewClientConn(conn net.PacketConn, addr net.Addr) *Client {
+	return &Client{opts: defaultClientOptions(), conn: conn, raddr: addr}
+}
+
+// Dial returns a long-lived Client that sends OSC packets to the address
+// `addr` on the named datagram network, see NewClientAddr. The Client keeps
+// one socket open until Close is called. If `addr` is a multicast group, the
+// ClientMulticast options control how packets are sent to it.
+func Dial(network, addr string, opts ...func(*clientOptions) error) (*Client, error) {
+	if err := checkPacketNetwork(network); err != nil {
+		return nil, err
+	}
+	o, err := newClientOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{opts: o, network: network, addr: addr, owned: true}
+	if err := c.dial(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// dial opens the socket of a client created by Dial.
+func (c *Client) dial() error {
+	raddr, err := resolveAddr(c.network, c.addr)
+	if err != nil {
+		return err
+	}
+
+	if c.network == "unixgram" && c.opts.localAddr == "" {
+		// An unnamed unix socket can only send if it is connected.
+		conn, err := net.DialUnix(c.network, nil, raddr.(*net.UnixAddr))
+		if err != nil {
+			return err
+		}
+		c.conn, c.connected, c.raddr = conn, true, raddr
+		return nil
+	}
+
+	conn, err := listenPacket(c.listenNetwork(raddr), c.opts.localAddr)
+	if err != nil {
+		return err
+	}
+	if err := setMulticastOptions(conn, raddr, c.opts); err != nil {
+		conn.Close()
+		return err
+	}
+	if c.opts.broadcast {
+		if err := controlSocket(conn, setBroadcast); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	c.conn, c.raddr, c.resolved = conn, raddr, c.clock().Now()
+	return nil
+}
+
+// listenNetwork returns the network of the socket that a client created with
+// Dial sends to `raddr` from. Broadcast and multicast options apply to a single
+// IP version, so those destinations are sent to from an IPv4 or IPv6 socket
+// instead of a dual-stack one.
+func (c *Client) listenNetwork(raddr net.Addr) string {
+	if c.network != "udp" {
+		return c.network
+	}
+	if c.opts.broadcast {
+		return "udp4"
+	}
+	if ua, ok := raddr.(*net.UDPAddr); ok && ua.IP.IsMulticast() {
+		if ua.IP.To4() != nil {
+			return "udp4"
+		}
+		return "udp6"
+	}
+	return c.network
+}
+
+// resolveAddr resolves the datagram address `addr` on `network`. It is a
+// variable so that tests can slow it down.
+var resolveAddr = func(network, addr string) (net.Addr, error) {
+	if network == "unixgram" {
+		return net.ResolveUnixAddr(network, addr)
+	}
+	return net.ResolveUDPAddr(network, addr)
 }
 
 // IP returns the IP address.
-func (c *Client) IP() string { return c.ip }
+func (c *Client) IP() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	host, _, _ := net.SplitHostPort(c.addr)
+	return host
+}
 
 // SetIp sets a new IP address.
-func (c *Client) SetIP(ip string) { c.ip = ip }
+func (c *Client) SetIP(ip string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, port, _ := net.SplitHostPort(c.addr)
+	c.setAddr(net.JoinHostPort(ip, port))
+}
 
 // Port returns the port.
-func (c *Client) Port() int { return c.port }
+func (c *Client) Port() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, port, _ := net.SplitHostPort(c.addr)
+	p, _ := strconv.Atoi(port)
+	return p
+}
 
 // SetPort sets a new port.
-func (c *Client) SetPort(port int) { c.port = port }
+func (c *Client) SetPort(port int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	host, _, _ := net.SplitHostPort(c.addr)
+	c.setAddr(net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// setAddr changes the destination address. A client created with Dial
+// resolves the new address on the next Send.
+func (c *Client) setAddr(addr string) {
+	c.addr = addr
+	if c.owned {
+		c.raddr = nil
+	}
+}
+
+// Network returns the name of the network packets are sent on.
+func (c *Client) Network() string { return c.network }
+
+// Addr returns the address packets are sent to.
+func (c *Client) Addr() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.addr
+}
 
-// SetLocalAddr sets the local address.
+// SetLocalAddr sets the local address. It has no effect on clients created
+// with Dial, see ClientLocalAddr.
 func (c *Client) SetLocalAddr(ip string, port int) error {
-	laddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", ip, port))
+	laddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(ip, strconv.Itoa(port)))
 	if err != nil {
 		return err
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.laddr = laddr
 	return nil
 }
 
-// Send the Packet `pkt`.
-func (c *Client) Send(pkt Packet) error {
-	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", c.ip, c.port))
-	if err != nil {
+// LocalAddr returns the local address of a client created with Dial or
+// NewClientConn, and nil otherwise.
+func (c *Client) LocalAddr() net.Addr {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.LocalAddr()
+}
+
+// Close releases the resources held by the client. The connection of a client
+// created with NewClientConn is left open.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || !c.owned {
+		c.closed = true
+		return nil
+	}
+	c.closed = true
+	err := c.conn.Close()
+	if isUnixSocketPath(c.network, c.opts.localAddr) {
+		os.Remove(c.opts.localAddr)
+	}
+	return err
+}
+
+// Handle registers a message handler function for packets received on the
+// client's own socket, such as replies and updates pushed by a device the
+// client has subscribed to. Receiving requires a client created with Dial or
+// NewClientConn. Handlers are called in order from the client's receive
+// goroutine, which starts with the first call to Handle or Request.
+func (c *Client) Handle(addr string, handler HandlerFunc) error {
+	if err := c.startReceiving(); err != nil {
 		return err
 	}
-	conn, err := net.DialUDP("udp", c.laddr, addr)
+	return c.dispatcher.AddMsgHandler(addr, handler)
+}
+
+// Request sends the Packet `pkt` and waits for the first message received on
+// the client's socket whose address matches the OSC address pattern
+// `replyAddr`. It returns an error if `ctx` is done before a reply arrives.
+// The reply is also dispatched to the handlers registered with Handle.
+func (c *Client) Request(ctx context.Context, pkt Packet, replyAddr string) (*Message, error) {
+	replies := make(chan *Message, 1)
+	stop, err := c.watch(replyAddr, func(msg *Message) bool {
+		select {
+		case replies <- msg:
+		default:
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	if err := c.SendContext(ctx, pkt); err != nil {
+		return nil, err
+	}
+	select {
+	case msg := <-replies:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Collect sends the Packet `pkt`, typically to a broadcast or multicast
+// address, and calls `handler` for every message received on the client's
+// socket whose address matches the OSC address pattern `replyAddr`, until
+// `window` has passed. It returns nil when the window closes, or the error of
+// `ctx` if it is done first. `handler` is called from the client's receive
+// goroutine and is never called after Collect returns.
+func (c *Client) Collect(ctx context.Context, pkt Packet, replyAddr string, window time.Duration, handler HandlerFunc) error {
+	var (
+		mu   sync.Mutex
+		done bool
+	)
+	stop, err := c.watch(replyAddr, func(msg *Message) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if done {
+			return true
+		}
+		handler(msg)
+		return false
+	})
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer func() {
+		stop()
+		mu.Lock()
+		done = true
+		mu.Unlock()
+	}()
+
+	wctx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+	if err := c.SendContext(wctx, pkt); err != nil {
+		return err
+	}
+	<-wctx.Done()
+	return ctx.Err()
+}
+
+// watcher observes the messages received by a client.
+type watcher struct {
+	re *regexp.Regexp // Addresses to observe; nil for all.
+	fn func(msg *Message) (done bool)
+}
+
+// watch calls `fn` for every received message whose address matches the OSC
+// address pattern `addr`, or for every message if `addr` is empty, until `fn`
+// returns true or the returned stop function is called. `fn` is called from
+// the receive goroutine and must not block.
+func (c *Client) watch(addr string, fn func(msg *Message) bool) (stop func(), err error) {
+	w := &watcher{fn: fn}
+	if addr != "" {
+		if w.re, err = compileAddressPattern(addr); err != nil {
+			return nil, fmt.Errorf("invalid OSC address pattern %q: %w", addr, err)
+		}
+	}
+	if err := c.startReceiving(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.watchers == nil {
+		c.watchers = make(map[*watcher]struct{})
+	}
+	c.watchers[w] = struct{}{}
+	return func() { c.unwatch(w) }, nil
+}
+
+func (c *Client) unwatch(w *watcher) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.watchers, w)
+}
+
+// startReceiving starts the receive goroutine once.
+func (c *Client) startReceiving() error {
+	if c.conn == nil {
+		return errors.New("client has no socket to receive on; use Dial")
+	}
+	c.recvOnce.Do(func() {
+		c.dispatcher = NewOSCDispatcher()
+		c.dispatcher.SetClock(c.opts.clock)
+		c.dispatcher.SetLogger(c.opts.logger)
+		c.dispatcher.SetTracer(c.opts.tracer)
+		go c.receive()
+	})
+	return nil
+}
+
+// receive reads packets from the client's socket until it is closed, and
+// hands them to watchers and handlers. Packets that cannot be decoded
+// are dropped.
+func (c *Client) receive() {
+	data := make([]byte, 65535)
+	var tempDelay time.Duration
+	for {
+		n, addr, err := c.conn.ReadFrom(data)
+		if err != nil {
+			var derr *DecodeError
+			if errors.As(err, &derr) {
+				c.opts.logger.Warn("dropped undecodable packet", "source", addrString(derr.Source), "error", derr.Err)
+				continue
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				tempDelay = nextTempDelay(tempDelay)
+				time.Sleep(tempDelay)
+				continue
+			}
+			return
+		}
+		tempDelay = 0
+
+		pkt, err := decodePacket(data[:n])
+		if err != nil {
+			c.opts.logger.Warn("dropped undecodable packet", "source", addrString(addr), "error", err)
+			continue
+		}
+		var reply Sender = &packetReplier{conn: c.conn, addr: addr}
+		if c.connected {
+			reply = c
+		}
+		setSource(pkt, addr, reply)
+		pkt = traceReceived(c.opts.tracer, pkt, n)
+		c.notifyWatchers(pkt)
+		c.dispatcher.Dispatch(pkt)
+	}
+}
+
+// notifyWatchers hands the messages in `pkt` to the watchers observing them.
+func (c *Client) notifyWatchers(pkt Packet) {
+	switch t := pkt.(type) {
+	case *Message:
+		c.mu.Lock()
+		var ws []*watcher
+		for w := range c.watchers {
+			if w.re == nil || w.re.MatchString(t.Address) {
+				ws = append(ws, w)
+			}
+		}
+		c.mu.Unlock()
+
+		for _, w := range ws {
+			if w.fn(t) {
+				c.unwatch(w)
+			}
+		}
+	case *Bundle:
+		for _, m := range t.Messages {
+			c.notifyWatchers(m)
+		}
+		for _, b := range t.Bundles {
+			c.notifyWatchers(b)
+		}
+	}
+}
+
+// Send the Packet `pkt`. Errors are of type *SendError.
+func (c *Client) Send(pkt Packet) error {
+	return c.SendContext(context.Background(), pkt)
+}
+
+// SendContext sends the Packet `pkt`. It gives up and returns the context's
+// error if `ctx` is done before the packet has been written. Packets larger
+// than a UDP datagram, or than the MTU set with ClientMTU, are rejected with
+// ErrPacketTooLarge. Errors are of type *SendError.
+func (c *Client) SendContext(ctx context.Context, pkt Packet) (err error) {
+	if _, ok := c.opts.tracer.(nopTracer); !ok {
+		var span Span
+		ctx, span = c.opts.tracer.Start(ctx, "osc.send", traceSendAttrs(c.destination(), pkt)...)
+		defer func() { span.End(err) }()
+		if p, ok := c.opts.tracer.(TracePropagator); ok {
+			if tc := p.Inject(ctx); tc != "" {
+				pkt = WithTraceContext(pkt, tc)
+			}
+		}
+	}
 
+	if err := ctx.Err(); err != nil {
+		return &SendError{Phase: SendPhaseWrite, Addr: c.destination(), Err: err}
+	}
 	data, err := pkt.MarshalBinary()
 	if err != nil {
-		return err
+		return &SendError{Phase: SendPhaseMarshal, Addr: c.destination(), Err: err}
+	}
+	return c.write(ctx, data)
+}
+
+// sendData sends the encoded packet `data` like SendContext, which records the
+// span of sending it and carries its trace context.
+func (c *Client) sendData(ctx context.Context, data []byte) (err error) {
+	if _, ok := c.opts.tracer.(nopTracer); !ok {
+		var span Span
+		ctx, span = c.opts.tracer.Start(ctx, "osc.send", slog.String("destination", c.destination()))
+		defer func() { span.End(err) }()
+		if p, ok := c.opts.tracer.(TracePropagator); ok {
+			if tc := p.Inject(ctx); tc != "" {
+				data = withTraceContextData(data, tc)
+			}
+		}
+	}
+	return c.sendRaw(ctx, data)
+}
+
+// sendRaw sends the encoded packet `data` as it is, without tracing.
+func (c *Client) sendRaw(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return &SendError{Phase: SendPhaseWrite, Addr: c.destination(), Err: err}
+	}
+	return c.write(ctx, data)
+}
+
+// destination returns the destination address for error messages.
+func (c *Client) destination() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.addr == "" && c.raddr != nil {
+		return c.raddr.String()
+	}
+	return c.addr
+}
+
+// write sends `data` as a single datagram.
+func (c *Client) write(ctx context.Context, data []byte) error {
+	if c.conn == nil {
+		return c.writeOnce(ctx, data)
+	}
+
+	dest := c.destination()
+	c.mu.Lock()
+	closed, raddr := c.closed, c.raddr
+	c.mu.Unlock()
+	if closed {
+		return &SendError{Phase: SendPhaseWrite, Addr: dest, Err: net.ErrClosed}
+	}
+	if !c.connected {
+		var err error
+		if raddr, err = c.remoteAddr(); err != nil {
+			return &SendError{Phase: SendPhaseResolve, Addr: dest, Err: err}
+		}
+	}
+
+	if err := checkDatagramSize(raddr, len(data), c.opts.mtu); err != nil {
+		return &SendError{Phase: SendPhaseSize, Addr: dest, Err: err}
 	}
 
+	if ctx.Done() == nil {
+		c.writeMu.RLock()
+		defer c.writeMu.RUnlock()
+	} else {
+		c.writeMu.Lock()
+		defer c.writeMu.Unlock()
+		stop := applyWriteDeadline(ctx, c.conn)
+		defer stop()
+	}
+	var err error
+	if c.connected {
+		_, err = c.conn.(net.Conn).Write(data)
+	} else {
+		_, err = c.conn.WriteTo(data, raddr)
+	}
+	if err != nil {
+		return &SendError{Phase: SendPhaseWrite, Addr: dest, Err: contextError(ctx, err)}
+	}
+	return nil
+}
+
+// clock returns the clock of the client.
+func (c *Client) clock() Clock {
+	return c.opts.clock
+}
+
+// remoteAddr returns the destination address, resolving it again if the
+// resolve interval has passed. If resolving fails, the previously resolved
+// address is kept. The lookup is done without holding c.mu, one at a time;
+// meanwhile, other sends use the previously resolved address, or wait for the
+// lookup if there is none. The caller must not hold c.mu.
+func (c *Client) remoteAddr() (net.Addr, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		if !c.owned {
+			return c.raddr, nil // Fixed address given to NewClientConn.
+		}
+		if c.raddr != nil && (c.opts.resolveInterval == 0 || c.clock().Now().Sub(c.resolved) < c.opts.resolveInterval) {
+			return c.raddr, nil
+		}
+		if c.resolving == nil {
+			break
+		}
+		if c.raddr != nil {
+			return c.raddr, nil
+		}
+		done := c.resolving
+		c.mu.Unlock()
+		<-done
+		c.mu.Lock()
+	}
+
+	done := make(chan struct{})
+	c.resolving = done
+	network, addr := c.network, c.addr
+	c.mu.Unlock()
+	raddr, err := resolveAddr(network, addr)
+	c.mu.Lock()
+	c.resolving = nil
+	close(done)
+	if err != nil {
+		if c.raddr != nil {
+			return c.raddr, nil
+		}
+		return nil, err
+	}
+	if c.addr == addr { // Not changed during the lookup.
+		c.raddr, c.resolved = raddr, c.clock().Now()
+	}
+	return raddr, nil
+}
+
+// writeOnce dials a new socket, sends `data` and closes the socket again.
+func (c *Client) writeOnce(ctx context.Context, data []byte) error {
+	c.mu.Lock()
+	network, addr := c.network, c.addr
+	var d net.Dialer
+	if c.laddr != nil {
+		d.LocalAddr = c.laddr
+	}
+	c.mu.Unlock()
+
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		phase := SendPhaseDial
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			phase = SendPhaseResolve
+		}
+		return &SendError{Phase: phase, Addr: addr, Err: err}
+	}
+	defer conn.Close()
+
+	if err := checkDatagramSize(conn.RemoteAddr(), len(data), 0); err != nil {
+		return &SendError{Phase: SendPhaseSize, Addr: addr, Err: err}
+	}
+	stop := applyWriteDeadline(ctx, conn)
+	defer stop()
 	if _, err = conn.Write(data); err != nil {
-		return err
+		return &SendError{Phase: SendPhaseWrite, Addr: addr, Err: contextError(ctx, err)}
 	}
 	return nil
 }
@@ -1,6 +1,17 @@
 package osc
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
 
 func TestClientSetLocalAddr(t *testing.T) {
 	client := NewClient("localhost", 8967)
@@ -13,3 +24,461 @@ func TestClientSetLocalAddr(t *testing.T) {
 		t.Errorf("Expected laddr to be %s but was %s", expectedAddr, client.laddr.String())
 	}
 }
+
+func TestClientAddr(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		ip   string
+		port int
+		addr string
+	}{
+		{"ipv4", "127.0.0.1", 8000, "127.0.0.1:8000"},
+		{"hostname", "localhost", 9000, "localhost:9000"},
+		{"ipv6", "::1", 57120, "[::1]:57120"},
+	} {
+		client := NewClient(tt.ip, tt.port)
+		if got, want := client.Addr(), tt.addr; got != want {
+			t.Errorf("%s: Addr() = %s, want = %s", tt.desc, got, want)
+		}
+		if got, want := client.IP(), tt.ip; got != want {
+			t.Errorf("%s: IP() = %s, want = %s", tt.desc, got, want)
+		}
+		if got, want := client.Port(), tt.port; got != want {
+			t.Errorf("%s: Port() = %d, want = %d", tt.desc, got, want)
+		}
+	}
+
+	client := NewClient("localhost", 8000)
+	client.SetIP("::1")
+	client.SetPort(9000)
+	if got, want := client.Addr(), "[::1]:9000"; got != want {
+		t.Errorf("Addr() after SetIP() and SetPort() = %s, want = %s", got, want)
+	}
+}
+
+// listenUDP returns a UDP connection on an ephemeral loopback port.
+func listenUDP(t *testing.T) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// receiveMessage reads a single OSC message from `conn`.
+func receiveMessage(t *testing.T, conn net.PacketConn) (*Message, net.Addr) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data := make([]byte, 65535)
+	n, addr, err := conn.ReadFrom(data)
+	if err != nil {
+		t.Fatalf("ReadFrom() unexpected error; %s", err)
+	}
+	pkt, err := decodePacket(data[:n])
+	if err != nil {
+		t.Fatalf("decodePacket() unexpected error; %s", err)
+	}
+	msg, ok := pkt.(*Message)
+	if !ok {
+		t.Fatalf("received %T, want *Message", pkt)
+	}
+	return msg, addr
+}
+
+func TestDialSourcePort(t *testing.T) {
+	server := listenUDP(t)
+	client, err := Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var from string
+	for i := 0; i < 3; i++ {
+		if err := client.Send(NewMessage("/n", int32(i))); err != nil {
+			t.Fatalf("Send() unexpected error; %s", err)
+		}
+		msg, addr := receiveMessage(t, server)
+		if got, want := msg.Arguments[0], int32(i); got != want {
+			t.Errorf("argument = %v, want = %v", got, want)
+		}
+		if from == "" {
+			from = addr.String()
+		}
+		if got, want := addr.String(), from; got != want {
+			t.Errorf("source address of packet %d = %s, want = %s", i, got, want)
+		}
+	}
+}
+
+func TestDialConcurrentSend(t *testing.T) {
+	server := listenUDP(t)
+	client, err := Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	const senders, count = 8, 16
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < count; j++ {
+				if err := client.Send(NewMessage("/c", int32(j))); err != nil {
+					t.Errorf("Send() unexpected error; %s", err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < senders*count; i++ {
+		receiveMessage(t, server)
+	}
+	wg.Wait()
+}
+
+func TestDialResolve(t *testing.T) {
+	first, second := listenUDP(t), listenUDP(t)
+	client, err := Dial("udp", first.LocalAddr().String(), ClientResolveInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := client.Send(NewMessage("/first")); err != nil {
+		t.Fatalf("Send() unexpected error; %s", err)
+	}
+	receiveMessage(t, first)
+
+	// Changing the port makes the client resolve the new address.
+	client.SetPort(second.LocalAddr().(*net.UDPAddr).Port)
+	if err := client.Send(NewMessage("/second")); err != nil {
+		t.Fatalf("Send() unexpected error; %s", err)
+	}
+	if msg, _ := receiveMessage(t, second); msg.Address != "/second" {
+		t.Errorf("address = %s, want = /second", msg.Address)
+	}
+}
+
+func TestDialSlowResolve(t *testing.T) {
+	clock := NewFakeClock(fakeClockStart)
+	conn := listenUDP(t)
+	client, err := Dial("udp", conn.LocalAddr().String(), ClientClock(clock), ClientResolveInterval(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// The next lookup blocks until released.
+	lookup, release := make(chan struct{}), make(chan struct{})
+	var releaseOnce sync.Once
+	unblock := func() { releaseOnce.Do(func() { close(release) }) }
+	defer unblock()
+	resolve := resolveAddr
+	defer func() { resolveAddr = resolve }()
+	resolveAddr = func(network, addr string) (net.Addr, error) {
+		close(lookup)
+		<-release
+		return resolve(network, addr)
+	}
+	clock.Advance(time.Minute)
+	go client.Send(NewMessage("/resolving"))
+	<-lookup
+
+	// Meanwhile, the client keeps sending to the previous address.
+	sent := make(chan error, 1)
+	go func() {
+		client.Addr()
+		sent <- client.Send(NewMessage("/meanwhile"))
+	}()
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Errorf("Send() unexpected error; %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send() blocked by a lookup in flight")
+	}
+	unblock()
+	got := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		msg, _ := receiveMessage(t, conn)
+		got[msg.Address] = true
+	}
+	if !got["/resolving"] || !got["/meanwhile"] {
+		t.Errorf("received %v, want /resolving and /meanwhile", got)
+	}
+}
+
+func TestDialClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.sock")
+	server, err := net.ListenPacket("unixgram", filepath.Join(t.TempDir(), "server.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := Dial("unixgram", server.LocalAddr().String(), ClientLocalAddr(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Send(NewMessage("/unix")); err != nil {
+		t.Fatalf("Send() unexpected error; %s", err)
+	}
+	if _, addr := receiveMessage(t, server); addr.String() != path {
+		t.Errorf("source address = %s, want = %s", addr, path)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Errorf("Close() unexpected error; %s", err)
+	}
+	if err := client.Send(NewMessage("/unix")); err == nil {
+		t.Error("Send() after Close() expected error")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("client socket file was not removed; %v", err)
+	}
+}
+
+// startServer serves `server` on an ephemeral loopback UDP port and returns
+// the listening address.
+func TestClientSendContext(t *testing.T) {
+	device := listenUDP(t)
+	client, err := Dial("udp", device.LocalAddr().String(), ClientMTU(1500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, tt := range []struct {
+		desc  string
+		ctx   context.Context
+		pkt   Packet
+		phase SendPhase
+		err   error
+	}{
+		{"unsupported argument", context.Background(), NewMessage("/x", struct{}{}), SendPhaseMarshal, nil},
+		{"larger than MTU", context.Background(), NewMessage("/x", string(make([]byte, 1500))), SendPhaseSize, ErrPacketTooLarge},
+		{"canceled", canceled, NewMessage("/x"), SendPhaseWrite, context.Canceled},
+	} {
+		err := client.SendContext(tt.ctx, tt.pkt)
+		var sendErr *SendError
+		if !errors.As(err, &sendErr) {
+			t.Errorf("%s: SendContext() = %v, want *SendError", tt.desc, err)
+			continue
+		}
+		if got, want := sendErr.Phase, tt.phase; got != want {
+			t.Errorf("%s: Phase = %s, want = %s", tt.desc, got, want)
+		}
+		if got, want := sendErr.Addr, device.LocalAddr().String(); got != want {
+			t.Errorf("%s: Addr = %s, want = %s", tt.desc, got, want)
+		}
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: SendContext() = %v, want %v", tt.desc, err, tt.err)
+		}
+	}
+
+	// Packets within the MTU are sent.
+	if err := client.SendContext(context.Background(), NewMessage("/x", string(make([]byte, 1000)))); err != nil {
+		t.Errorf("SendContext() unexpected error; %s", err)
+	}
+	receiveMessage(t, device)
+
+	// Without an MTU, only the UDP limit applies.
+	err = NewClient("127.0.0.1", 9000).Send(NewMessage("/x", string(make([]byte, maxUDPPayload))))
+	if !errors.Is(err, ErrPacketTooLarge) {
+		t.Errorf("Send() = %v, want %v", err, ErrPacketTooLarge)
+	}
+}
+
+func TestClientSendContextDeadline(t *testing.T) {
+	// Nobody reads from the other end of the pipe, so writes block.
+	local, remote := net.Pipe()
+	defer remote.Close()
+	conn, err := NewSerialConn(local, FramingSLIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := NewClientConn(conn, conn.RemoteAddr())
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.SendContext(ctx, NewMessage("/x")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SendContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func startServer(t *testing.T, server *Server) string {
+	t.Helper()
+	conn := listenUDP(t)
+	go server.Serve(context.Background(), conn)
+	t.Cleanup(func() { server.Close() })
+	return conn.LocalAddr().String()
+}
+
+func TestClientRequest(t *testing.T) {
+	server, err := NewServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.Handle("/info", func(msg *Message) {
+		msg.Reply(NewMessage("/info/reply", "X32", int32(4)))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Dial("udp", startServer(t, server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reply, err := client.Request(ctx, NewMessage("/info"), "/info/*")
+	if err != nil {
+		t.Fatalf("Request() unexpected error; %s", err)
+	}
+	if got, want := reply.String(), "/info/reply ,si X32 4"; got != want {
+		t.Errorf("Request() = %s, want = %s", got, want)
+	}
+
+	// Nothing replies to /status.
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Request(ctx, NewMessage("/status"), "/status"); err != context.DeadlineExceeded {
+		t.Errorf("Request() error = %v, want = %v", err, context.DeadlineExceeded)
+	}
+
+	if _, err := client.Request(ctx, NewMessage("/info"), "/info/["); err == nil {
+		t.Error("Request() expected error for invalid reply address")
+	}
+}
+
+func TestClientCollect(t *testing.T) {
+	device := listenUDP(t)
+	other := listenUDP(t)
+	client, err := Dial("udp", device.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Two responders answer the ping, and one also sends an unrelated message.
+	go func() {
+		device.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, from, err := device.ReadFrom(make([]byte, 1024))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for _, r := range []struct {
+			conn net.PacketConn
+			msg  *Message
+		}{
+			{device, NewMessage("/pong", "device")},
+			{other, NewMessage("/status", "busy")},
+			{other, NewMessage("/pong", "other")},
+		} {
+			data, err := r.msg.MarshalBinary()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := r.conn.WriteTo(data, from); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	var got []string
+	if err := client.Collect(context.Background(), NewMessage("/ping"), "/pong", 500*time.Millisecond, func(msg *Message) {
+		got = append(got, msg.Arguments[0].(string))
+	}); err != nil {
+		t.Fatalf("Collect() unexpected error; %s", err)
+	}
+	if want := []string{"device", "other"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Collect() replies = %v, want = %v", got, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.Collect(ctx, NewMessage("/ping"), "/pong", time.Second, func(*Message) {}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Collect() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestDialBroadcast(t *testing.T) {
+	listener, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.LocalAddr().(*net.UDPAddr).Port
+
+	client, err := Dial("udp", net.JoinHostPort("255.255.255.255", strconv.Itoa(port)), ClientBroadcast(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Send(NewMessage("/who")); err != nil {
+		t.Skipf("broadcast not supported; %s", err)
+	}
+	if msg, _ := receiveMessage(t, listener); msg.Address != "/who" {
+		t.Errorf("received %v, want /who", msg)
+	}
+}
+
+func TestClientHandle(t *testing.T) {
+	device := listenUDP(t)
+	client, err := Dial("udp", device.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	meters := make(chan *Message, 2)
+	if err := client.Handle("/meters/1", func(msg *Message) { meters <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Send(NewMessage("/xremote")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The device pushes updates to the port the subscription came from.
+	_, from := receiveMessage(t, device)
+	for i := int32(0); i < 2; i++ {
+		data, err := NewMessage("/meters/1", i).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := device.WriteTo(data, from); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := int32(0); i < 2; i++ {
+		select {
+		case msg := <-meters:
+			if got, want := msg.Arguments[0], i; got != want {
+				t.Errorf("update %d = %v, want = %v", i, got, want)
+			}
+			if got, want := msg.Addr(), device.LocalAddr().String(); got != want {
+				t.Errorf("update %d Addr() = %s, want = %s", i, got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for update")
+		}
+	}
+
+	if err := NewClient("localhost", 9000).Handle("/meters", func(*Message) {}); err == nil {
+		t.Error("Handle() on a client without socket expected error")
+	}
+}
@@ -0,0 +1,249 @@
+package osc
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for scheduling bundles and for everything else
+// that waits, so that tests can replace the system clock with a FakeClock and
+// simulate the passing of time and clock skew.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a Timer that sends the time on its channel after at
+	// least the duration `d`.
+	NewTimer(d time.Duration) Timer
+	// AfterFunc waits for the duration `d` and then calls `f`. The channel
+	// of the returned Timer is nil.
+	AfterFunc(d time.Duration, f func()) Timer
+	// NewTicker returns a Ticker that sends the time on its channel every
+	// period `d`.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a single event of a Clock, see time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker delivers ticks of a Clock at intervals, see time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+	Reset(d time.Duration)
+}
+
+// SystemClock is the Clock of the operating system, which is used by default.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return systemTimer{time.AfterFunc(d, f)}
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTimer struct{ *time.Timer }
+
+func (t systemTimer) C() <-chan time.Time { return t.Timer.C }
+
+type systemTicker struct{ *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// FakeClock is a Clock for tests whose time only changes when Advance or Set
+// is called. Timers and tickers fire while the clock is advanced, in the order
+// of their deadlines.
+type FakeClock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond // Signaled when timers are added.
+	now    time.Time
+	timers map[*fakeTimer]struct{}
+	seq    uint64 // Incremented for every timer that is started.
+}
+
+// Verify that interfaces are implemented properly.
+var _ Clock = (*FakeClock)(nil)
+
+// NewFakeClock returns a FakeClock set to the time `now`.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now, timers: make(map[*fakeTimer]struct{})}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now implements the Clock interface.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer implements the Clock interface.
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// AfterFunc implements the Clock interface. The function `f` is called from
+// the goroutine that advances the clock.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	t := &fakeTimer{clock: c, fn: f}
+	t.Reset(d)
+	return t
+}
+
+// NewTicker implements the Clock interface.
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1), period: d}
+	t.Reset(d)
+	return fakeTicker{t}
+}
+
+// Advance moves the clock forward by `d` and fires the timers and tickers
+// that become due, at their deadlines.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	c.mu.Unlock()
+	c.advanceTo(end)
+}
+
+// Set sets the clock to the time `t`. Setting the clock back does not fire
+// any timers, which simulates clock skew.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	if t.Before(c.now) {
+		c.now = t
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	c.advanceTo(t)
+}
+
+// BlockUntil blocks until at least `n` timers and tickers are waiting, which
+// lets tests advance the clock only after the code under test has started
+// waiting.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+// advanceTo fires the timers due until `end` one at a time, so that functions
+// called by timers can add new timers, and then sets the clock to `end`.
+func (c *FakeClock) advanceTo(end time.Time) {
+	for {
+		c.mu.Lock()
+		t := c.nextTimer(end)
+		if t == nil {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		now := c.now
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+		} else {
+			delete(c.timers, t)
+		}
+		c.mu.Unlock()
+
+		if t.fn != nil {
+			t.fn()
+			continue
+		}
+		select {
+		case t.ch <- now:
+		default: // Drop the tick, like time.Ticker.
+		}
+	}
+}
+
+// nextTimer returns the timer with the earliest deadline not after `end`. The
+// caller must hold c.mu.
+func (c *FakeClock) nextTimer(end time.Time) *fakeTimer {
+	var due []*fakeTimer
+	for t := range c.timers {
+		if !t.when.After(end) {
+			due = append(due, t)
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].when.Equal(due[j].when) {
+			return due[i].seq < due[j].seq
+		}
+		return due[i].when.Before(due[j].when)
+	})
+	return due[0]
+}
+
+// fakeTimer is a timer or ticker of a FakeClock.
+type fakeTimer struct {
+	clock  *FakeClock
+	ch     chan time.Time
+	fn     func()
+	period time.Duration // Zero for timers.
+	when   time.Time
+	seq    uint64 // Orders timers with the same deadline.
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, active := c.timers[t]
+	delete(c.timers, t)
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, active := c.timers[t]
+	c.seq++
+	t.seq = c.seq
+	t.when = c.now.Add(d)
+	c.timers[t] = struct{}{}
+	c.cond.Broadcast()
+	return active
+}
+
+type fakeTicker struct{ t *fakeTimer }
+
+func (t fakeTicker) C() <-chan time.Time { return t.t.ch }
+func (t fakeTicker) Stop()               { t.t.Stop() }
+
+func (t fakeTicker) Reset(d time.Duration) {
+	t.t.period = d
+	t.t.Reset(d)
+}
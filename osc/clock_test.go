@@ -0,0 +1,89 @@
+package osc
+
+import (
+	"testing"
+	"time"
+)
+
+var fakeClockStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeClockTimers(t *testing.T) {
+	clock := NewFakeClock(fakeClockStart)
+	var fired []time.Duration
+	record := func() { fired = append(fired, clock.Now().Sub(fakeClockStart)) }
+	clock.AfterFunc(3*time.Second, record)
+	clock.AfterFunc(1*time.Second, record)
+	stopped := clock.AfterFunc(2*time.Second, record)
+	timer := clock.NewTimer(2 * time.Second)
+
+	if !stopped.Stop() {
+		t.Error("Stop returned false for an active timer")
+	}
+	clock.Advance(2 * time.Second)
+	select {
+	case now := <-timer.C():
+		if got, want := now, fakeClockStart.Add(2*time.Second); !got.Equal(want) {
+			t.Errorf("timer fired at %s, want %s", got, want)
+		}
+	default:
+		t.Error("timer has not fired")
+	}
+	if got, want := clock.Now(), fakeClockStart.Add(2*time.Second); !got.Equal(want) {
+		t.Errorf("Now() = %s, want %s", got, want)
+	}
+
+	// Setting the clock back must not fire the remaining timer.
+	clock.Set(fakeClockStart)
+	clock.Advance(2 * time.Second)
+	if got, want := len(fired), 1; got != want {
+		t.Fatalf("%d timers fired, want %d", got, want)
+	}
+	clock.Advance(time.Second)
+	if got, want := fired, []time.Duration{time.Second, 3 * time.Second}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("timers fired at %v, want %v", got, want)
+	}
+	if timer.Reset(time.Second) {
+		t.Error("Reset returned true for an expired timer")
+	}
+}
+
+func TestFakeClockTicker(t *testing.T) {
+	clock := NewFakeClock(fakeClockStart)
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for i := 1; i <= 3; i++ {
+		clock.Advance(time.Second)
+		select {
+		case now := <-ticker.C():
+			if got, want := now, fakeClockStart.Add(time.Duration(i)*time.Second); !got.Equal(want) {
+				t.Errorf("tick %d at %s, want %s", i, got, want)
+			}
+		default:
+			t.Fatalf("no tick %d", i)
+		}
+	}
+
+	// Ticks that are not received are dropped.
+	clock.Advance(5 * time.Second)
+	<-ticker.C()
+	select {
+	case now := <-ticker.C():
+		t.Errorf("unexpected tick at %s", now)
+	default:
+	}
+}
+
+func TestFakeClockBlockUntil(t *testing.T) {
+	clock := NewFakeClock(fakeClockStart)
+	done := make(chan time.Time)
+	go func() {
+		done <- <-clock.NewTimer(time.Minute).C()
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	if got, want := <-done, fakeClockStart.Add(time.Minute); !got.Equal(want) {
+		t.Errorf("timer fired at %s, want %s", got, want)
+	}
+}
@@ -22,7 +22,12 @@ Features:
 - Message dispatching with pattern matching via server.Handle()
 
 This OSC implementation uses the UDP protocol for sending and receiving
-OSC packets.
+OSC packets. StreamServer and StreamClient carry OSC packets over stream
+transports such as TCP. Packets are framed either with their size as a
+big-endian int32 (OSC 1.0) or with SLIP double-END encoding (OSC 1.1), see
+ServerFraming and ClientFraming. SerialConn carries framed packets over a
+serial line or any other io.ReadWriteCloser, so that a Server can serve it
+and a Client created with NewClientConn can send through it.
 
 The unit of transmission of OSC is an OSC Packet. Any application that sends
 OSC Packets is an OSC Client; any application that receives OSC Packets is
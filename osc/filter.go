@@ -0,0 +1,174 @@
+package osc
+
+import (
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// sourceFilter drops the packets of sources that are not allowed by the
+// ServerAllow and ServerDeny lists, and of sources that exceed the rate set
+// with ServerSourceRate. It is safe for concurrent use.
+type sourceFilter struct {
+	allow, deny []netip.Prefix
+	rate        float64 // Tokens per second; 0 for no limit.
+	burst       float64
+	onThrottled func(source net.Addr)
+	clock       Clock
+	logger      *slog.Logger
+	metrics     Metrics
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket // By source IP address.
+	sweepAt int                     // Size of buckets that triggers a sweep.
+}
+
+// tokenBucket is the rate limit of a single source.
+type tokenBucket struct {
+	tokens    float64
+	last      time.Time // Time tokens was last updated.
+	throttled bool      // Packets are being dropped.
+}
+
+// minSweepAt is the smallest number of sources at which full buckets are
+// swept, which bounds the memory taken by sources that have gone quiet.
+const minSweepAt = 1024
+
+// newSourceFilter returns the sourceFilter set by the options `o`, or nil if
+// all sources are accepted.
+func newSourceFilter(o *serverOptions) *sourceFilter {
+	if len(o.allow) == 0 && len(o.deny) == 0 && o.sourceRate == 0 {
+		return nil
+	}
+	return &sourceFilter{
+		allow:       o.allow,
+		deny:        o.deny,
+		rate:        o.sourceRate,
+		burst:       float64(o.sourceBurst),
+		onThrottled: o.onThrottled,
+		clock:       o.clock,
+		logger:      o.logger,
+		metrics:     o.metrics,
+		buckets:     make(map[string]*tokenBucket),
+		sweepAt:     minSweepAt,
+	}
+}
+
+// admit reports whether a packet from `source` may be decoded.
+func (f *sourceFilter) admit(source net.Addr) bool {
+	return f.allows(source) && f.take(source)
+}
+
+// allows reports whether `source` is allowed by the allow and deny lists.
+// Sources without an IP address, such as unix sockets, are only allowed if
+// there is no allow list.
+func (f *sourceFilter) allows(source net.Addr) bool {
+	ip, ok := sourceIP(source)
+	if ok && containsIP(f.deny, ip) || len(f.allow) > 0 && !(ok && containsIP(f.allow, ip)) {
+		f.metrics.PacketDropped("denied")
+		f.logger.Debug("dropped packet from denied source", "source", addrString(source))
+		return false
+	}
+	return true
+}
+
+// take takes a token from the bucket of `source` and reports whether there
+// was one. The hook set with ServerOnThrottled is called when a source starts
+// being throttled.
+func (f *sourceFilter) take(source net.Addr) bool {
+	if f.rate == 0 {
+		return true
+	}
+	key := addrString(source)
+	if ip, ok := sourceIP(source); ok {
+		key = ip.String() // All ports of a host share its bucket.
+	}
+
+	f.mu.Lock()
+	now := f.clock.Now()
+	b := f.buckets[key]
+	if b == nil {
+		if len(f.buckets) >= f.sweepAt {
+			f.sweep(now)
+		}
+		b = &tokenBucket{tokens: f.burst, last: now}
+		f.buckets[key] = b
+	}
+	b.refill(now, f.rate, f.burst)
+	if b.tokens >= 1 {
+		b.tokens--
+		b.throttled = false
+		f.mu.Unlock()
+		return true
+	}
+	started := !b.throttled
+	b.throttled = true
+	f.mu.Unlock()
+
+	f.metrics.PacketDropped("throttled")
+	f.logger.Debug("dropped packet from throttled source", "source", addrString(source))
+	if started && f.onThrottled != nil {
+		f.onThrottled(source)
+	}
+	return false
+}
+
+// sweep removes the buckets that have refilled completely, as they are the
+// same as new ones. The caller must hold f.mu.
+func (f *sourceFilter) sweep(now time.Time) {
+	for key, b := range f.buckets {
+		if b.refill(now, f.rate, f.burst); b.tokens >= f.burst {
+			delete(f.buckets, key)
+		}
+	}
+	f.sweepAt = max(2*len(f.buckets), minSweepAt)
+}
+
+// refill adds the tokens earned since the last update, up to `burst`.
+func (b *tokenBucket) refill(now time.Time, rate, burst float64) {
+	if d := now.Sub(b.last); d > 0 {
+		b.tokens = min(b.tokens+d.Seconds()*rate, burst)
+	}
+	b.last = now
+}
+
+// sourceIP returns the IP address of `addr`, with IPv4-mapped IPv6 addresses
+// unmapped and without an IPv6 zone, which prefixes never contain, if it has
+// one.
+func sourceIP(addr net.Addr) (netip.Addr, bool) {
+	var ap netip.AddrPort
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ap = a.AddrPort()
+	case *net.TCPAddr:
+		ap = a.AddrPort()
+	default:
+		return netip.Addr{}, false
+	}
+	return ap.Addr().Unmap().WithZone(""), ap.Addr().IsValid()
+}
+
+func containsIP(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefix parses the CIDR prefix `s`, such as "10.0.0.0/8", or a single IP
+// address.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p.Masked(), nil
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	ip = ip.Unmap()
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
@@ -0,0 +1,169 @@
+package osc
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSourceFilterAllows(t *testing.T) {
+	o := &serverOptions{logger: discardLogger, metrics: nopMetrics{}}
+	for _, opt := range []func(*serverOptions) error{
+		ServerAllow("192.168.1.0/24"),
+		ServerAllow("2001:db8::/32"),
+		ServerAllow("10.0.0.5"),
+		ServerAllow("fe80::/10"),
+		ServerDeny("192.168.1.13"),
+		ServerDeny("fe80::13"),
+	} {
+		if err := opt(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := newSourceFilter(o)
+
+	for _, tt := range []struct {
+		desc   string
+		source net.Addr
+		want   bool
+	}{
+		{"allowed prefix", &net.UDPAddr{IP: net.ParseIP("192.168.1.20"), Port: 9000}, true},
+		{"denied address", &net.UDPAddr{IP: net.ParseIP("192.168.1.13"), Port: 9000}, false},
+		{"allowed address", &net.UDPAddr{IP: net.ParseIP("10.0.0.5"), Port: 9000}, true},
+		{"other address", &net.UDPAddr{IP: net.ParseIP("10.0.0.6"), Port: 9000}, false},
+		{"IPv4-mapped", &net.UDPAddr{IP: net.ParseIP("::ffff:192.168.1.20"), Port: 9000}, true},
+		{"IPv6", &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 9000}, true},
+		{"allowed link-local", &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 9000, Zone: "eth0"}, true},
+		{"denied link-local", &net.UDPAddr{IP: net.ParseIP("fe80::13"), Port: 9000, Zone: "eth0"}, false},
+		{"unix socket", &net.UnixAddr{Name: "/tmp/osc.sock", Net: "unixgram"}, false},
+		{"no address", nil, false},
+	} {
+		if got := f.allows(tt.source); got != tt.want {
+			t.Errorf("%s: allows(%v) = %v, want %v", tt.desc, tt.source, got, tt.want)
+		}
+	}
+
+	// A zone does not get a source past a deny list.
+	o = &serverOptions{logger: discardLogger, metrics: nopMetrics{}}
+	if err := ServerDeny("fe80::/10")(o); err != nil {
+		t.Fatal(err)
+	}
+	zoned := &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 9000, Zone: "eth0"}
+	if newSourceFilter(o).admit(zoned) {
+		t.Errorf("admit(%v) = true with a deny list of fe80::/10", zoned)
+	}
+
+	if newSourceFilter(&serverOptions{}) != nil {
+		t.Error("newSourceFilter() without options is not nil")
+	}
+}
+
+func TestSourceFilterOptionErrors(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		opt  func(*serverOptions) error
+	}{
+		{"invalid allow", ServerAllow("192.168.1.0/33")},
+		{"invalid deny", ServerDeny("localhost")},
+		{"zero rate", ServerSourceRate(0, 1)},
+		{"zero burst", ServerSourceRate(10, 0)},
+	} {
+		if _, err := NewServer("", tt.opt); err == nil {
+			t.Errorf("%s: NewServer() expected error", tt.desc)
+		}
+	}
+}
+
+func TestSourceFilterRate(t *testing.T) {
+	clock := NewFakeClock(fakeClockStart)
+	var throttled []string
+	o := &serverOptions{clock: clock, logger: discardLogger, metrics: nopMetrics{}}
+	for _, opt := range []func(*serverOptions) error{
+		ServerSourceRate(2, 2),
+		ServerOnThrottled(func(source net.Addr) { throttled = append(throttled, source.String()) }),
+	} {
+		if err := opt(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := newSourceFilter(o)
+	laptop := &net.UDPAddr{IP: net.ParseIP("192.168.1.13"), Port: 9000}
+	laptopOtherPort := &net.UDPAddr{IP: net.ParseIP("192.168.1.13"), Port: 9001}
+	console := &net.UDPAddr{IP: net.ParseIP("192.168.1.20"), Port: 9000}
+
+	for _, tt := range []struct {
+		desc    string
+		advance time.Duration
+		source  net.Addr
+		want    bool
+	}{
+		{"first of burst", 0, laptop, true},
+		{"second of burst", 0, laptop, true},
+		{"beyond burst", 0, laptop, false},
+		{"other port", 0, laptopOtherPort, false},
+		{"other source", 0, console, true},
+		{"half a token", 250 * time.Millisecond, laptop, false},
+		{"refilled token", 250 * time.Millisecond, laptop, true},
+		{"throttled again", 0, laptop, false},
+	} {
+		clock.Advance(tt.advance)
+		if got := f.take(tt.source); got != tt.want {
+			t.Errorf("%s: take(%s) = %v, want %v", tt.desc, tt.source, got, tt.want)
+		}
+	}
+	if got, want := len(throttled), 2; got != want {
+		t.Errorf("throttled %d times (%v), want %d", got, throttled, want)
+	}
+}
+
+func TestServerSourceRate(t *testing.T) {
+	clock := NewFakeClock(fakeClockStart)
+	throttled := make(chan net.Addr, 1)
+	server, err := NewServer("",
+		ServerClock(clock),
+		ServerSourceRate(1, 1),
+		ServerOnThrottled(func(source net.Addr) { throttled <- source }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 10)
+	for _, addr := range []string{"/a", "/b", "/c"} {
+		if err := server.Handle(addr, func(msg *Message) { received <- msg.Address }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn, err := net.Dial("udp", startServer(t, server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	send := func(addr string) {
+		data, err := NewMessage(addr).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send("/a")
+	send("/b")
+	select {
+	case <-throttled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("source not throttled")
+	}
+	clock.Advance(time.Second)
+	send("/c")
+	for _, want := range []string{"/a", "/c"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not dispatched", want)
+		}
+	}
+}
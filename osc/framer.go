@@ -0,0 +1,220 @@
+package osc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// maxFrameSize is the largest OSC packet accepted from a stream transport.
+const maxFrameSize = 16 << 20
+
+// Framing selects how OSC packets are delimited on a stream transport.
+type Framing int
+
+const (
+	// FramingLengthPrefix precedes each packet with its size as a big-endian
+	// int32, as specified by OSC 1.0.
+	FramingLengthPrefix Framing = iota
+	// FramingSLIP encodes each packet with SLIP (RFC 1055) and delimits it with
+	// an END byte on both sides, as specified by OSC 1.1.
+	FramingSLIP
+)
+
+// String implements the fmt.Stringer interface.
+func (f Framing) String() string {
+	switch f {
+	case FramingLengthPrefix:
+		return "length-prefix"
+	case FramingSLIP:
+		return "slip"
+	}
+	return fmt.Sprintf("Framing(%d)", int(f))
+}
+
+func (f Framing) validate() error {
+	switch f {
+	case FramingLengthPrefix, FramingSLIP:
+		return nil
+	}
+	return fmt.Errorf("unsupported framing: %s", f)
+}
+
+// Framer reads and writes OSC packets as frames on a byte stream. Stream
+// transports have no datagram boundaries, so every packet is framed before it
+// is written. A Framer supports one reader and any number of concurrent
+// writers.
+type Framer interface {
+	// ReadFrame returns the next frame. It returns io.EOF when the stream ends
+	// cleanly between frames.
+	ReadFrame() ([]byte, error)
+	// WriteFrame writes `data` as a single frame.
+	WriteFrame(data []byte) error
+}
+
+// NewFramer returns a Framer for `rw` that uses the framing mode `f`.
+func NewFramer(rw io.ReadWriter, f Framing) (Framer, error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	if f == FramingSLIP {
+		return NewSLIPFramer(rw), nil
+	}
+	return NewLengthPrefixFramer(rw), nil
+}
+
+// NewLengthPrefixFramer returns a Framer that implements the OSC 1.0 stream
+// framing, where each packet is preceded by its size as a big-endian int32.
+func NewLengthPrefixFramer(rw io.ReadWriter) Framer {
+	return &lengthPrefixFramer{r: bufio.NewReader(rw), w: rw}
+}
+
+type lengthPrefixFramer struct {
+	r  *bufio.Reader
+	mu sync.Mutex // Serializes writes.
+	w  io.Writer
+}
+
+// ReadFrame implements the Framer interface.
+func (f *lengthPrefixFramer) ReadFrame() ([]byte, error) {
+	var size int32
+	if err := binary.Read(f.r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size < 0 || size > maxFrameSize {
+		return nil, fmt.Errorf("invalid frame size: %d", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// WriteFrame implements the Framer interface.
+func (f *lengthPrefixFramer) WriteFrame(data []byte) error {
+	if len(data) > maxFrameSize {
+		return fmt.Errorf("frame too large: %d bytes", len(data))
+	}
+	buf := new(bytes.Buffer)
+	if err := binary.Write(buf, binary.BigEndian, int32(len(data))); err != nil {
+		return err
+	}
+	buf.Write(data)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err := f.w.Write(buf.Bytes())
+	return err
+}
+
+// SLIP special characters, see RFC 1055.
+const (
+	slipEnd    = 0xc0
+	slipEsc    = 0xdb
+	slipEscEnd = 0xdc
+	slipEscEsc = 0xdd
+)
+
+// errMalformedSLIP is returned for frames containing an invalid escape
+// sequence.
+var errMalformedSLIP = errors.New("malformed SLIP escape sequence")
+
+// NewSLIPFramer returns a Framer that implements the OSC 1.1 stream framing,
+// where each packet is SLIP encoded and enclosed in END bytes. Empty frames
+// are skipped when reading. A frame with an invalid escape sequence is
+// discarded up to its closing END and reported as an error, after which
+// reading can continue with the next frame.
+func NewSLIPFramer(rw io.ReadWriter) Framer {
+	return &slipFramer{r: bufio.NewReader(rw), w: rw}
+}
+
+type slipFramer struct {
+	r  *bufio.Reader
+	mu sync.Mutex // Serializes writes.
+	w  io.Writer
+}
+
+// ReadFrame implements the Framer interface.
+func (f *slipFramer) ReadFrame() ([]byte, error) {
+	var (
+		frame []byte
+		n     int  // Number of bytes read for the current frame.
+		esc   bool // Previous byte was ESC.
+		err   error
+	)
+	for {
+		b, rerr := f.r.ReadByte()
+		if rerr != nil {
+			if rerr == io.EOF && n > 0 {
+				rerr = io.ErrUnexpectedEOF
+			}
+			return nil, rerr
+		}
+		if b == slipEnd {
+			if esc {
+				err = errMalformedSLIP
+			}
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 {
+				continue // Skip empty frames.
+			}
+			return frame, nil
+		}
+		n++
+		if err != nil {
+			continue // Discard the rest of a bad frame.
+		}
+
+		switch {
+		case esc:
+			esc = false
+			switch b {
+			case slipEscEnd:
+				frame = append(frame, slipEnd)
+			case slipEscEsc:
+				frame = append(frame, slipEsc)
+			default:
+				err = errMalformedSLIP
+			}
+		case b == slipEsc:
+			esc = true
+		default:
+			frame = append(frame, b)
+		}
+		if len(frame) > maxFrameSize {
+			err = fmt.Errorf("frame too large: more than %d bytes", maxFrameSize)
+		}
+	}
+}
+
+// WriteFrame implements the Framer interface.
+func (f *slipFramer) WriteFrame(data []byte) error {
+	buf := make([]byte, 0, len(data)+len(data)/8+2)
+	buf = append(buf, slipEnd)
+	for _, b := range data {
+		switch b {
+		case slipEnd:
+			buf = append(buf, slipEsc, slipEscEnd)
+		case slipEsc:
+			buf = append(buf, slipEsc, slipEscEsc)
+		default:
+			buf = append(buf, b)
+		}
+	}
+	buf = append(buf, slipEnd)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err := f.w.Write(buf)
+	return err
+}
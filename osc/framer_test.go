@@ -0,0 +1,156 @@
+package osc
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestLengthPrefixFramer(t *testing.T) {
+	for _, tt := range []struct {
+		desc   string
+		frames [][]byte
+		wire   []byte
+	}{
+		{"empty_frame", [][]byte{{}}, []byte{0, 0, 0, 0}},
+		{"one_frame", [][]byte{{1, 2, 3, 4}}, []byte{0, 0, 0, 4, 1, 2, 3, 4}},
+		{"two_frames",
+			[][]byte{{1, 2, 3, 4}, {5, 6, 7, 8}},
+			[]byte{0, 0, 0, 4, 1, 2, 3, 4, 0, 0, 0, 4, 5, 6, 7, 8}},
+	} {
+		buf := new(bytes.Buffer)
+		f := NewLengthPrefixFramer(buf)
+		for _, frame := range tt.frames {
+			if err := f.WriteFrame(frame); err != nil {
+				t.Fatalf("%s: WriteFrame() unexpected error; %s", tt.desc, err)
+			}
+		}
+		if got, want := buf.Bytes(), tt.wire; !bytes.Equal(got, want) {
+			t.Errorf("%s: wire = %v, want = %v", tt.desc, got, want)
+		}
+
+		var frames [][]byte
+		for {
+			frame, err := f.ReadFrame()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: ReadFrame() unexpected error; %s", tt.desc, err)
+			}
+			frames = append(frames, frame)
+		}
+		if got, want := frames, tt.frames; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: frames = %v, want = %v", tt.desc, got, want)
+		}
+	}
+}
+
+func TestLengthPrefixFramerInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		wire []byte
+	}{
+		{"negative_size", []byte{0xff, 0xff, 0xff, 0xfc}},
+		{"oversized", []byte{0x7f, 0xff, 0xff, 0xff}},
+		{"truncated_size", []byte{0, 0}},
+		{"truncated_data", []byte{0, 0, 0, 8, 1, 2, 3, 4}},
+	} {
+		f := NewLengthPrefixFramer(bytes.NewBuffer(tt.wire))
+		if _, err := f.ReadFrame(); err == nil || err == io.EOF {
+			t.Errorf("%s: ReadFrame() = %v, want a framing error", tt.desc, err)
+		}
+	}
+}
+
+func TestSLIPFramer(t *testing.T) {
+	for _, tt := range []struct {
+		desc  string
+		frame []byte
+		wire  []byte
+	}{
+		{"plain", []byte{1, 2, 3, 4}, []byte{0xc0, 1, 2, 3, 4, 0xc0}},
+		{"end", []byte{0xc0}, []byte{0xc0, 0xdb, 0xdc, 0xc0}},
+		{"esc", []byte{0xdb}, []byte{0xc0, 0xdb, 0xdd, 0xc0}},
+		{"esc_chars", []byte{0xdc, 0xdd}, []byte{0xc0, 0xdc, 0xdd, 0xc0}},
+		{"mixed", []byte{0xdb, 0xc0, 7}, []byte{0xc0, 0xdb, 0xdd, 0xdb, 0xdc, 7, 0xc0}},
+	} {
+		buf := new(bytes.Buffer)
+		f := NewSLIPFramer(buf)
+		if err := f.WriteFrame(tt.frame); err != nil {
+			t.Fatalf("%s: WriteFrame() unexpected error; %s", tt.desc, err)
+		}
+		if got, want := buf.Bytes(), tt.wire; !bytes.Equal(got, want) {
+			t.Errorf("%s: wire = %v, want = %v", tt.desc, got, want)
+		}
+		frame, err := f.ReadFrame()
+		if err != nil {
+			t.Fatalf("%s: ReadFrame() unexpected error; %s", tt.desc, err)
+		}
+		if got, want := frame, tt.frame; !bytes.Equal(got, want) {
+			t.Errorf("%s: ReadFrame() = %v, want = %v", tt.desc, got, want)
+		}
+	}
+}
+
+func TestSLIPFramerRead(t *testing.T) {
+	for _, tt := range []struct {
+		desc   string
+		wire   []byte
+		frames []interface{} // []byte for a frame, error for a read error.
+	}{
+		{"single_end", []byte{1, 2, 0xc0}, []interface{}{[]byte{1, 2}}},
+		{"empty_frames", []byte{0xc0, 0xc0, 0xc0, 1, 0xc0, 0xc0}, []interface{}{[]byte{1}}},
+		{"bad_escape",
+			[]byte{0xc0, 0xdb, 0x01, 2, 0xc0, 3, 0xc0},
+			[]interface{}{errMalformedSLIP, []byte{3}}},
+		{"esc_before_end",
+			[]byte{0xc0, 1, 0xdb, 0xc0, 0xc0, 4, 0xc0},
+			[]interface{}{errMalformedSLIP, []byte{4}}},
+		{"truncated", []byte{0xc0, 1, 2}, []interface{}{io.ErrUnexpectedEOF}},
+		{"truncated_escape", []byte{0xc0, 0xdb}, []interface{}{io.ErrUnexpectedEOF}},
+	} {
+		f := NewSLIPFramer(bytes.NewBuffer(tt.wire))
+		for i, want := range tt.frames {
+			frame, err := f.ReadFrame()
+			if werr, ok := want.(error); ok {
+				if err != werr {
+					t.Errorf("%s: ReadFrame() #%d error = %v, want = %v", tt.desc, i, err, werr)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: ReadFrame() #%d unexpected error; %s", tt.desc, i, err)
+				continue
+			}
+			if got, want := frame, want.([]byte); !bytes.Equal(got, want) {
+				t.Errorf("%s: ReadFrame() #%d = %v, want = %v", tt.desc, i, got, want)
+			}
+		}
+		if _, err := f.ReadFrame(); err != io.EOF {
+			if len(tt.frames) > 0 {
+				if _, ok := tt.frames[len(tt.frames)-1].(error); ok {
+					continue
+				}
+			}
+			t.Errorf("%s: final ReadFrame() error = %v, want = %v", tt.desc, err, io.EOF)
+		}
+	}
+}
+
+func TestNewFramer(t *testing.T) {
+	for _, tt := range []struct {
+		framing Framing
+		ok      bool
+	}{
+		{FramingLengthPrefix, true},
+		{FramingSLIP, true},
+		{Framing(-1), false},
+	} {
+		_, err := NewFramer(new(bytes.Buffer), tt.framing)
+		if got, want := err == nil, tt.ok; got != want {
+			t.Errorf("NewFramer(%s) error = %v, want ok = %t", tt.framing, err, want)
+		}
+	}
+}
@@ -3,9 +3,11 @@ package osc
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"reflect"
 	"regexp"
@@ -18,6 +20,8 @@ type Message struct {
 	Address   string
 	Arguments []interface{}
 	addr      string // Source address of packet.
+	reply     Sender // Reply path to the source of the packet.
+	ctx       context.Context
 }
 
 // Verify that interfaces are implemented properly.
@@ -34,6 +38,27 @@ func (msg *Message) Addr() string { return msg.addr }
 // SetAddr implements the Packet interface.
 func (msg *Message) SetAddr(addr net.Addr) { msg.addr = addr.String() }
 
+// Reply sends the Packet `pkt` back to the peer the message was received from.
+// It returns an error if the message was not received by a server or client.
+func (msg *Message) Reply(pkt Packet) error {
+	if msg.reply == nil {
+		return errors.New("message has no reply path")
+	}
+	return msg.reply.Send(pkt)
+}
+
+// Context returns the context the message is handled in. For a message
+// received by a server or client with a Tracer, it holds the span of the
+// handler, so that handlers can start spans of their own and continue the
+// trace by passing it to Client.SendContext. Otherwise, it is
+// context.Background().
+func (msg *Message) Context() context.Context {
+	if msg.ctx == nil {
+		return context.Background()
+	}
+	return msg.ctx
+}
+
 // Append appends the given arguments to the arguments list.
 func (msg *Message) Append(args ...interface{}) {
 	msg.Arguments = append(msg.Arguments, args...)
@@ -101,8 +126,7 @@ func (msg *Message) String() string {
 
 		case Timetag:
 			format += " %d"
-			timeTag := arg.(Timetag)
-			args = append(args, timeTag.TimeTag())
+			args = append(args, arg.(Timetag).TimeTag())
 		}
 	}
 
@@ -224,6 +248,18 @@ func (msg *Message) MarshalBinary() ([]byte, error) {
 // getRegEx compiles and returns a regular expression object for the given
 // address `pattern`.
 func getRegEx(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(translatePattern(pattern))
+}
+
+// compileAddressPattern compiles the OSC address `pattern` to a regular
+// expression that only matches complete OSC addresses.
+func compileAddressPattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + translatePattern(pattern) + ")$")
+}
+
+// translatePattern translates the OSC address `pattern` to the syntax of
+// regular expressions.
+func translatePattern(pattern string) string {
 	for _, trs := range []struct {
 		old, new string
 	}{
@@ -238,8 +274,7 @@ func getRegEx(pattern string) *regexp.Regexp {
 	} {
 		pattern = strings.Replace(pattern, trs.old, trs.new, -1)
 	}
-
-	return regexp.MustCompile(pattern)
+	return pattern
 }
 
 // getTypeTag returns the OSC type tag for the given argument.
@@ -300,8 +335,8 @@ func readArguments(msg *Message, reader *bufio.Reader, start *int) error {
 	*start += n
 
 	// If the typetag doesn't start with ',', it's not valid
-	if typetags[0] != ',' {
-		return errors.New("unsupported type tag string")
+	if len(typetags) == 0 || typetags[0] != ',' {
+		return errTypeTagString
 	}
 
 	// Remove ',' from the type tag
@@ -310,7 +345,7 @@ func readArguments(msg *Message, reader *bufio.Reader, start *int) error {
 	for _, c := range typetags {
 		switch c {
 		default:
-			return fmt.Errorf("unsupported type tag: %c", c)
+			return fmt.Errorf("%w: %c", errTypeTag, c)
 
 		case 'i': // int32
 			var i int32
@@ -365,7 +400,7 @@ func readArguments(msg *Message, reader *bufio.Reader, start *int) error {
 		case 't': // OSC time tag
 			var tt uint64
 			if err = binary.Read(reader, binary.BigEndian, &tt); err != nil {
-				return nil
+				return err
 			}
 			*start += 8
 			msg.Append(NewTimetagFromTimetag(tt))
@@ -389,15 +424,20 @@ func readArguments(msg *Message, reader *bufio.Reader, start *int) error {
 // removed from the reader and not returned.
 func readBlob(reader *bufio.Reader) ([]byte, int, error) {
 	// First, get the length
-	var blobLen int
-	if err := binary.Read(reader, binary.BigEndian, &blobLen); err != nil {
+	var length int32
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
 		return nil, 0, err
 	}
+	if length < 0 {
+		return nil, 0, fmt.Errorf("invalid blob length: %d", length)
+	}
+	blobLen := int(length)
 	n := 4 + blobLen
 
-	// Read the data
-	blob := make([]byte, blobLen)
-	if _, err := reader.Read(blob); err != nil {
+	// Read the data. The buffer grows with the data actually read, so a
+	// bogus length cannot allocate more memory than the packet has.
+	var blob bytes.Buffer
+	if _, err := io.CopyN(&blob, reader, int64(blobLen)); err != nil {
 		return nil, 0, err
 	}
 
@@ -405,13 +445,12 @@ func readBlob(reader *bufio.Reader) ([]byte, int, error) {
 	numPadBytes := padBytesNeeded(blobLen)
 	if numPadBytes > 0 {
 		n += numPadBytes
-		dummy := make([]byte, numPadBytes)
-		if _, err := reader.Read(dummy); err != nil {
+		if _, err := reader.Discard(numPadBytes); err != nil {
 			return nil, 0, err
 		}
 	}
 
-	return blob, n, nil
+	return blob.Bytes(), n, nil
 }
 
 // writeBlob writes the data byte array as an OSC blob into buff. If the length
@@ -0,0 +1,61 @@
+package osc
+
+import (
+	"net"
+	"time"
+)
+
+// Metrics receives measurements of the traffic of servers and dispatchers.
+// Implementations must be safe for concurrent use. PrometheusMetrics is an
+// implementation that serves the measurements to Prometheus.
+type Metrics interface {
+	// PacketReceived counts a packet of `size` bytes received from the
+	// host `source`, including packets that cannot be decoded. The host is
+	// the IP address of the sender without its port, or the path of its
+	// unix socket.
+	PacketReceived(source string, size int)
+	// PacketDropped counts a packet that is dropped before it is decoded,
+	// by the reason: "denied" for sources that are not allowed and
+	// "throttled" for sources that exceed their rate.
+	PacketDropped(reason string)
+	// DecodeFailed counts a packet that cannot be decoded, by the kind of
+	// error, see DecodeError.Kind.
+	DecodeFailed(kind string)
+	// MessageDispatched counts a message dispatched to the handler
+	// registered for the OSC address `address`, once for every matching
+	// handler.
+	MessageDispatched(address string)
+	// MessageUnmatched counts a message to the OSC address `address` that
+	// matched no handler.
+	MessageUnmatched(address string)
+	// HandlerDone observes how long the handler registered for the OSC
+	// address `address` took to handle a message.
+	HandlerDone(address string, d time.Duration)
+	// BundleDue observes how late a bundle is dispatched after the time of
+	// its time tag.
+	BundleDue(late time.Duration)
+	// QueueDepth sets the number of bundles waiting for the time of their
+	// time tag.
+	QueueDepth(n int)
+}
+
+// nopMetrics is the default Metrics, which discards all measurements.
+type nopMetrics struct{}
+
+func (nopMetrics) PacketReceived(string, int)        {}
+func (nopMetrics) PacketDropped(string)              {}
+func (nopMetrics) DecodeFailed(string)               {}
+func (nopMetrics) MessageDispatched(string)          {}
+func (nopMetrics) MessageUnmatched(string)           {}
+func (nopMetrics) HandlerDone(string, time.Duration) {}
+func (nopMetrics) BundleDue(time.Duration)           {}
+func (nopMetrics) QueueDepth(int)                    {}
+
+// sourceHost returns the host of the source address `addr` for metrics. The
+// port is left out, as senders pick it at random.
+func sourceHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
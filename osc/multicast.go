@@ -0,0 +1,133 @@
+package osc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ListenMulticast joins the multicast group `group`, given as host and port,
+// on the network interface named `iface` and serves the packets sent to the
+// group. If `iface` is empty, the system chooses the interface. The server's
+// network must be "udp", "udp4" or "udp6".
+func (s *Server) ListenMulticast(group, iface string) error {
+	s.setDefaults()
+	if !strings.HasPrefix(s.opts.network, "udp") {
+		return fmt.Errorf("multicast is not supported on network: %q", s.opts.network)
+	}
+	gaddr, err := net.ResolveUDPAddr(s.opts.network, group)
+	if err != nil {
+		return err
+	}
+	if !gaddr.IP.IsMulticast() {
+		return fmt.Errorf("not a multicast address: %s", gaddr.IP)
+	}
+	var ifi *net.Interface
+	if iface != "" {
+		if ifi, err = net.InterfaceByName(iface); err != nil {
+			return err
+		}
+	}
+	conn, err := net.ListenMulticastUDP(s.opts.network, ifi, gaddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return s.Serve(context.Background(), conn)
+}
+
+// ClientMulticastTTL sets the time-to-live of multicast packets sent by a
+// client created with Dial, which limits how many routers they cross. The
+// system default is 1, which keeps packets on the local network.
+func ClientMulticastTTL(v int) func(*clientOptions) error {
+	return func(o *clientOptions) error { return o.setMulticastTTL(v) }
+}
+
+func (o *clientOptions) setMulticastTTL(v int) error {
+	if v < 1 || v > 255 {
+		return fmt.Errorf("multicast TTL out of range: %d", v)
+	}
+	o.multicastTTL = v
+	return nil
+}
+
+// ClientMulticastLoopback sets whether multicast packets sent by a client
+// created with Dial are also delivered to members of the group on the local
+// host. The system default is true.
+func ClientMulticastLoopback(v bool) func(*clientOptions) error {
+	return func(o *clientOptions) error { return o.setMulticastLoopback(v) }
+}
+
+func (o *clientOptions) setMulticastLoopback(v bool) error {
+	o.noMulticastLoopback = !v
+	return nil
+}
+
+// ClientMulticastInterface sets the name of the network interface that a
+// client created with Dial sends multicast packets on. By default, the system
+// chooses the interface.
+func ClientMulticastInterface(v string) func(*clientOptions) error {
+	return func(o *clientOptions) error { return o.setMulticastInterface(v) }
+}
+
+func (o *clientOptions) setMulticastInterface(v string) error {
+	o.multicastInterface = v
+	return nil
+}
+
+// setMulticastOptions applies the multicast options in `o` to `conn` if
+// `raddr` is a multicast group.
+func setMulticastOptions(conn net.PacketConn, raddr net.Addr, o *clientOptions) error {
+	ua, ok := raddr.(*net.UDPAddr)
+	if !ok || !ua.IP.IsMulticast() {
+		return nil
+	}
+	if o.multicastTTL == 0 && !o.noMulticastLoopback && o.multicastInterface == "" {
+		return nil
+	}
+	mo := multicastOptions{
+		ipv6:       ua.IP.To4() == nil,
+		ttl:        o.multicastTTL,
+		noLoopback: o.noMulticastLoopback,
+	}
+	if o.multicastInterface != "" {
+		ifi, err := net.InterfaceByName(o.multicastInterface)
+		if err != nil {
+			return err
+		}
+		mo.ifIndex = ifi.Index
+		if !mo.ipv6 {
+			if mo.ifAddr, err = interfaceIPv4(ifi); err != nil {
+				return err
+			}
+		}
+	}
+
+	return controlSocket(conn, mo.set)
+}
+
+// multicastOptions are the multicast socket options of a client.
+type multicastOptions struct {
+	ipv6       bool
+	ttl        int // Zero for the system default.
+	noLoopback bool
+	ifIndex    int     // Zero for the system default.
+	ifAddr     [4]byte // IPv4 address of the interface.
+}
+
+// interfaceIPv4 returns the first IPv4 address of `ifi`.
+func interfaceIPv4(ifi *net.Interface) ([4]byte, error) {
+	var ip [4]byte
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return ip, err
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && n.IP.To4() != nil {
+			copy(ip[:], n.IP.To4())
+			return ip, nil
+		}
+	}
+	return ip, fmt.Errorf("interface %s has no IPv4 address", ifi.Name)
+}
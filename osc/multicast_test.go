@@ -0,0 +1,109 @@
+package osc
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// loopbackInterface returns the name of the loopback interface.
+func loopbackInterface(t *testing.T) string {
+	t.Helper()
+	ifs, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ifi := range ifs {
+		if ifi.Flags&net.FlagLoopback != 0 && ifi.Flags&net.FlagUp != 0 {
+			return ifi.Name
+		}
+	}
+	t.Skip("no loopback interface")
+	return ""
+}
+
+// freeUDPPort returns a UDP port that is not in use.
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+	conn := listenUDP(t)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+	return port
+}
+
+func TestMulticast(t *testing.T) {
+	iface := loopbackInterface(t)
+	group := net.JoinHostPort("239.255.77.77", strconv.Itoa(freeUDPPort(t)))
+
+	server, err := NewServer(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cues := make(chan *Message, 1)
+	if err := server.Handle("/cue/go", func(msg *Message) {
+		select {
+		case cues <- msg:
+		default:
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.ListenMulticast(group, iface) }()
+	defer server.Close()
+
+	client, err := Dial("udp", group,
+		ClientMulticastInterface(iface),
+		ClientMulticastTTL(1),
+		ClientMulticastLoopback(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// The server may not have joined the group yet, so keep sending.
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+	for {
+		if err := client.Send(NewMessage("/cue/go", int32(7))); err != nil {
+			t.Skipf("multicast not supported on %s: %s", iface, err)
+		}
+		select {
+		case msg := <-cues:
+			if got, want := msg.Arguments[0], int32(7); got != want {
+				t.Errorf("cue = %v, want = %v", got, want)
+			}
+			return
+		case err := <-served:
+			t.Skipf("multicast not supported on %s: %s", iface, err)
+		case <-ticker.C:
+		case <-timeout:
+			t.Fatal("timed out waiting for multicast cue")
+		}
+	}
+}
+
+func TestMulticastError(t *testing.T) {
+	server, err := NewServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.ListenMulticast("127.0.0.1:9000", ""); err == nil {
+		t.Error("ListenMulticast() on a unicast address expected error")
+	}
+	server, err = NewServer("", ServerNetwork("unixgram"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.ListenMulticast("239.255.77.77:9000", ""); err == nil {
+		t.Error("ListenMulticast() on unixgram expected error")
+	}
+	if _, err := Dial("udp", "239.255.77.77:9000", ClientMulticastTTL(256)); err == nil {
+		t.Error("Dial() with TTL 256 expected error")
+	}
+	if _, err := Dial("udp", "239.255.77.77:9000", ClientMulticastInterface("no-such-interface")); err == nil {
+		t.Error("Dial() on unknown interface expected error")
+	}
+}
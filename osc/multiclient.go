@@ -0,0 +1,203 @@
+package osc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MultiClient sends every packet to several destinations, for example a main
+// console, a backup console and a logger. Each packet is encoded once and the
+// same bytes are sent to all destinations that do not rewrite addresses.
+// Destinations can be any Sender, such as a Client or a StreamClient, and may
+// be added and removed while packets are being sent.
+type MultiClient struct {
+	mu    sync.RWMutex
+	dests map[string]*destination
+}
+
+// Verify that interfaces are implemented properly.
+var _ Sender = (*MultiClient)(nil)
+
+// destination is a Sender of a MultiClient.
+type destination struct {
+	sender Sender
+	opts   *destinationOptions
+}
+
+type destinationOptions struct {
+	rewrite func(addr string) string
+}
+
+// DestinationRewrite sets a function that rewrites the OSC address of every
+// message sent to the destination, for example to add a prefix for a logger.
+func DestinationRewrite(v func(addr string) string) func(*destinationOptions) error {
+	return func(o *destinationOptions) error { return o.setRewrite(v) }
+}
+
+func (o *destinationOptions) setRewrite(v func(addr string) string) error {
+	o.rewrite = v
+	return nil
+}
+
+// NewMultiClient returns a MultiClient without destinations.
+func NewMultiClient() *MultiClient {
+	return &MultiClient{dests: make(map[string]*destination)}
+}
+
+// Add adds the destination `s` under `name`, which identifies it in errors
+// and to Remove. The MultiClient does not take ownership of `s`.
+func (m *MultiClient) Add(name string, s Sender, opts ...func(*destinationOptions) error) error {
+	o := &destinationOptions{}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.dests[name]; ok {
+		return fmt.Errorf("destination already exists: %q", name)
+	}
+	m.dests[name] = &destination{sender: s, opts: o}
+	return nil
+}
+
+// Remove removes the destination `name` and returns its Sender, or nil if
+// there is no such destination.
+func (m *MultiClient) Remove(name string) Sender {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.dests[name]
+	if !ok {
+		return nil
+	}
+	delete(m.dests, name)
+	return d.sender
+}
+
+// Destinations returns the names of the destinations in sorted order.
+func (m *MultiClient) Destinations() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.dests))
+	for name := range m.dests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Send sends the Packet `pkt` to all destinations, see SendContext.
+func (m *MultiClient) Send(pkt Packet) error {
+	return m.SendContext(context.Background(), pkt)
+}
+
+// SendContext sends the Packet `pkt` to all destinations at once and waits
+// until every send has finished. If sending to any destination fails, it
+// returns a *MultiSendError with the error of each failed destination.
+// Cancellation of `ctx` applies to Client and StreamClient destinations.
+func (m *MultiClient) SendContext(ctx context.Context, pkt Packet) error {
+	data, err := pkt.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	dests := make(map[string]*destination, len(m.dests))
+	for name, d := range m.dests {
+		dests[name] = d
+	}
+	m.mu.RUnlock()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs map[string]error
+	)
+	for name, d := range dests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.send(ctx, pkt, data); err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				if errs == nil {
+					errs = make(map[string]error)
+				}
+				errs[name] = err
+			}
+		}()
+	}
+	wg.Wait()
+	if errs != nil {
+		return &MultiSendError{Errors: errs, Total: len(dests)}
+	}
+	return nil
+}
+
+// send sends `pkt`, encoded as `data`, to the destination.
+func (d *destination) send(ctx context.Context, pkt Packet, data []byte) error {
+	if d.opts.rewrite != nil {
+		var err error
+		pkt = rewritePacket(pkt, d.opts.rewrite)
+		if data, err = pkt.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+	if ds, ok := d.sender.(dataSender); ok {
+		return ds.sendData(ctx, data)
+	}
+	return d.sender.Send(pkt)
+}
+
+// rewritePacket returns a copy of `pkt` with the address of every message
+// rewritten by `fn`.
+func rewritePacket(pkt Packet, fn func(addr string) string) Packet {
+	switch p := pkt.(type) {
+	case *Message:
+		return &Message{Address: fn(p.Address), Arguments: p.Arguments}
+	case *Bundle:
+		b := &Bundle{Timetag: p.Timetag}
+		for _, m := range p.Messages {
+			b.Messages = append(b.Messages, rewritePacket(m, fn).(*Message))
+		}
+		for _, sb := range p.Bundles {
+			b.Bundles = append(b.Bundles, rewritePacket(sb, fn).(*Bundle))
+		}
+		return b
+	}
+	return pkt
+}
+
+// MultiSendError is returned by MultiClient.Send if sending to one or more
+// destinations failed.
+type MultiSendError struct {
+	Errors map[string]error // Errors by destination name.
+	Total  int              // Number of destinations sent to.
+}
+
+func (e *MultiSendError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %v", name, e.Errors[name])
+	}
+	return fmt.Sprintf("send failed for %d of %d destinations: %s", len(e.Errors), e.Total, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of the failed destinations, for errors.Is and
+// errors.As.
+func (e *MultiSendError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
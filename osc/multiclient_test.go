@@ -0,0 +1,108 @@
+package osc
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSender records the packets sent to it, or fails with err.
+type recordingSender struct {
+	mu   sync.Mutex
+	pkts []Packet
+	err  error
+}
+
+func (s *recordingSender) Send(pkt Packet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.pkts = append(s.pkts, pkt)
+	return nil
+}
+
+func TestMultiClient(t *testing.T) {
+	main, backup := listenUDP(t), listenUDP(t)
+	m := NewMultiClient()
+	for name, conn := range map[string]interface{ LocalAddr() net.Addr }{"main": main, "backup": backup} {
+		c, err := Dial("udp", conn.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		if err := m.Add(name, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logger := &recordingSender{}
+	if err := m.Add("logger", logger, DestinationRewrite(func(addr string) string { return "/log" + addr })); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add("logger", logger); err == nil {
+		t.Error("Add() of an existing destination expected error")
+	}
+
+	bundle := NewBundle(time.Now())
+	bundle.Append(NewMessage("/fader/1", float32(0.5)))
+	if err := m.Send(bundle); err != nil {
+		t.Fatalf("Send() unexpected error; %s", err)
+	}
+	for _, conn := range []net.PacketConn{main, backup} {
+		data := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkt, err := decodePacket(data[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := pkt.(*Bundle).Messages[0].Address, "/fader/1"; got != want {
+			t.Errorf("%s received %s, want = %s", conn.LocalAddr(), got, want)
+		}
+	}
+	if got, want := logger.pkts[0].(*Bundle).Messages[0].Address, "/log/fader/1"; got != want {
+		t.Errorf("logger received %s, want = %s", got, want)
+	}
+	if got, want := bundle.Messages[0].Address, "/fader/1"; got != want {
+		t.Errorf("rewrite changed the sent bundle to %s, want = %s", got, want)
+	}
+
+	errBroken := errors.New("broken")
+	if err := m.Add("broken", &recordingSender{err: errBroken}); err != nil {
+		t.Fatal(err)
+	}
+	err := m.Send(NewMessage("/fader/1", float32(0.25)))
+	var multiErr *MultiSendError
+	if !errors.As(err, &multiErr) {
+		t.Fatalf("Send() = %v, want *MultiSendError", err)
+	}
+	if got, want := len(multiErr.Errors), 1; got != want {
+		t.Errorf("failed destinations = %d, want = %d", got, want)
+	}
+	if got, want := multiErr.Total, 4; got != want {
+		t.Errorf("Total = %d, want = %d", got, want)
+	}
+	if !errors.Is(err, errBroken) {
+		t.Errorf("Send() = %v, want %v", err, errBroken)
+	}
+
+	if m.Remove("broken") == nil {
+		t.Error("Remove() of an existing destination returned nil")
+	}
+	if m.Remove("broken") != nil {
+		t.Error("Remove() of a removed destination returned a Sender")
+	}
+	if got, want := strings.Join(m.Destinations(), ","), "backup,logger,main"; got != want {
+		t.Errorf("Destinations() = %s, want = %s", got, want)
+	}
+	if err := m.Send(NewMessage("/fader/1", float32(0))); err != nil {
+		t.Errorf("Send() unexpected error; %s", err)
+	}
+}
@@ -0,0 +1,154 @@
+package osc
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// checkPacketNetwork returns an error if `network` is not a datagram network
+// supported by Server and Client.
+func checkPacketNetwork(network string) error {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return nil
+	}
+	return fmt.Errorf("unsupported datagram network: %q", network)
+}
+
+// checkStreamNetwork returns an error if `network` is not a stream network
+// supported by StreamServer and StreamClient.
+func checkStreamNetwork(network string) error {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return nil
+	}
+	return fmt.Errorf("unsupported stream network: %q", network)
+}
+
+// isUnixSocketPath returns true if `addr` on `network` refers to a unix socket
+// in the file system, as opposed to an abstract or unnamed socket.
+func isUnixSocketPath(network, addr string) bool {
+	return strings.HasPrefix(network, "unix") && addr != "" && addr[0] != '@'
+}
+
+// listenPacket announces on the local datagram address. Stale unix socket
+// files are removed first.
+func listenPacket(network, addr string) (net.PacketConn, error) {
+	if err := checkPacketNetwork(network); err != nil {
+		return nil, err
+	}
+	if isUnixSocketPath(network, addr) {
+		if err := removeStaleSocket(network, addr); err != nil {
+			return nil, err
+		}
+	}
+	return net.ListenPacket(network, addr)
+}
+
+// listenStream announces on the local stream address. Stale unix socket files
+// are removed first.
+func listenStream(network, addr string) (net.Listener, error) {
+	if err := checkStreamNetwork(network); err != nil {
+		return nil, err
+	}
+	if isUnixSocketPath(network, addr) {
+		if err := removeStaleSocket(network, addr); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen(network, addr)
+}
+
+// removeStaleSocket removes the unix socket file at `path` if it is left over
+// from a process that is no longer listening on it. It refuses to remove
+// sockets that are in use and files that are not sockets.
+func removeStaleSocket(network, path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.Dial(network, path); err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is in use", path)
+	}
+	return os.Remove(path)
+}
+
+// controlSocket calls `fn` with the file descriptor of the socket of `conn`,
+// for example to set socket options.
+func controlSocket(conn net.PacketConn, fn func(fd uintptr) error) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return fmt.Errorf("cannot set socket options on %T", conn)
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ferr error
+	if err := rc.Control(func(fd uintptr) { ferr = fn(fd) }); err != nil {
+		return err
+	}
+	return ferr
+}
+
+// closerSet tracks the listeners and connections of a server, so that they
+// can be closed when the server is closed. The zero value is ready to use.
+type closerSet struct {
+	mu      sync.Mutex
+	closers map[io.Closer]struct{}
+	closed  bool
+}
+
+// add registers `c` to be closed by closeAll. It returns false if the set is
+// already closed.
+func (s *closerSet) add(c io.Closer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.closers == nil {
+		s.closers = make(map[io.Closer]struct{})
+	}
+	s.closers[c] = struct{}{}
+	return true
+}
+
+func (s *closerSet) remove(c io.Closer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.closers, c)
+}
+
+func (s *closerSet) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// closeAll closes all registered closers and marks the set as closed. It
+// returns the first error encountered.
+func (s *closerSet) closeAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var err error
+	for c := range s.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
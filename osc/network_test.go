@@ -0,0 +1,168 @@
+package osc
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitForFile waits until the file at `path` exists.
+func waitForFile(t *testing.T, path string) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(5 * time.Millisecond) {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", path)
+}
+
+func TestUnixgramServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "osc.sock")
+	server, err := NewServer(path, ServerNetwork("unixgram"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan *Message, 1)
+	if err := server.Handle("/unix", func(msg *Message) { received <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- server.ListenAndServe() }()
+	waitForFile(t, path)
+
+	client, err := NewClientAddr("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Send(NewMessage("/unix", int32(1))); err != nil {
+		t.Fatalf("Send() unexpected error; %s", err)
+	}
+	select {
+	case msg := <-received:
+		if got, want := msg.String(), "/unix ,i 1"; got != want {
+			t.Errorf("message = %s, want = %s", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+
+	server.Close()
+	select {
+	case err := <-done:
+		if err != ErrServerClosed {
+			t.Errorf("ListenAndServe() = %v, want = %v", err, ErrServerClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ListenAndServe() did not return after Close()")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file was not removed; %v", err)
+	}
+}
+
+func TestUnixStreamServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "osc.sock")
+	server, err := NewStreamServer(path, ServerNetwork("unix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan *Message, 1)
+	if err := server.Handle("/unix", func(msg *Message) { received <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- server.ListenAndServe() }()
+	waitForFile(t, path)
+
+	client, err := DialStream("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Send(NewMessage("/unix", "stream")); err != nil {
+		t.Fatalf("Send() unexpected error; %s", err)
+	}
+	select {
+	case msg := <-received:
+		if got, want := msg.String(), "/unix ,s stream"; got != want {
+			t.Errorf("message = %s, want = %s", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+
+	server.Close()
+	select {
+	case err := <-done:
+		if err != ErrServerClosed {
+			t.Errorf("ListenAndServe() = %v, want = %v", err, ErrServerClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ListenAndServe() did not return after Close()")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file was not removed; %v", err)
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+
+	// Closing a unixgram socket leaves its file behind.
+	stale := filepath.Join(dir, "stale.sock")
+	conn, err := net.ListenPacket("unixgram", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if err := removeStaleSocket("unixgram", stale); err != nil {
+		t.Errorf("removeStaleSocket(stale) unexpected error; %s", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale socket was not removed; %v", err)
+	}
+
+	live := filepath.Join(dir, "live.sock")
+	conn, err = net.ListenPacket("unixgram", live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := removeStaleSocket("unixgram", live); err == nil {
+		t.Error("removeStaleSocket(live) expected error")
+	}
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket("unixgram", file); err == nil {
+		t.Error("removeStaleSocket(file) expected error")
+	}
+
+	if err := removeStaleSocket("unixgram", filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("removeStaleSocket(missing) unexpected error; %s", err)
+	}
+}
+
+func TestNetworks(t *testing.T) {
+	if _, err := NewClientAddr("unix", "/tmp/osc.sock"); err == nil {
+		t.Error("NewClientAddr(unix) expected error")
+	}
+	if _, err := DialStream("udp", "127.0.0.1:0"); err == nil {
+		t.Error("DialStream(udp) expected error")
+	}
+	if _, err := NewServer("", ServerNetwork("ip")); err == nil {
+		t.Error("NewServer() expected error for network ip")
+	}
+	server, err := NewServer("", ServerNetwork("tcp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.ListenAndServe(); err == nil {
+		t.Error("ListenAndServe() expected error for network tcp")
+	}
+}
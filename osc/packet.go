@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"encoding"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 )
 
@@ -25,6 +27,73 @@ func ParsePacket(msg string) (Packet, error) {
 	return readPacket(bufio.NewReader(bytes.NewBufferString(msg)), &start, len(msg))
 }
 
+// decodePacket decodes a single OSC packet from `data`.
+func decodePacket(data []byte) (Packet, error) {
+	var start int
+	return readPacket(bufio.NewReader(bytes.NewReader(data)), &start, len(data))
+}
+
+// Errors of packets that cannot be decoded, which classify DecodeError values.
+var (
+	errInvalidPacket = errors.New("invalid packet")
+	errTypeTagString = errors.New("unsupported type tag string")
+	errTypeTag       = errors.New("unsupported type tag")
+)
+
+// DecodeError is the error of a received packet that cannot be decoded. Unlike
+// errors of the transport, it only concerns a single packet, and servers keep
+// serving after it.
+type DecodeError struct {
+	Source net.Addr // Source address of the packet; nil if unknown.
+	Data   []byte   // The packet.
+	Err    error
+}
+
+func (e *DecodeError) Error() string { return e.Err.Error() }
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// Kind classifies the error for metrics: "truncated" for packets that end too
+// early, "unknown_packet" for packets that are neither messages nor bundles,
+// "type_tag" for unsupported type tags and "malformed" for all others.
+func (e *DecodeError) Kind() string {
+	switch {
+	case errors.Is(e.Err, io.EOF), errors.Is(e.Err, io.ErrUnexpectedEOF):
+		return "truncated"
+	case errors.Is(e.Err, errInvalidPacket):
+		return "unknown_packet"
+	case errors.Is(e.Err, errTypeTagString), errors.Is(e.Err, errTypeTag):
+		return "type_tag"
+	}
+	return "malformed"
+}
+
+// addrString returns the string form of `addr`, which may be nil.
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+// setSource records the source address and reply path of a received packet.
+// Messages nested within bundles inherit both from the enclosing bundle.
+func setSource(pkt Packet, addr net.Addr, reply Sender) {
+	if addr != nil {
+		pkt.SetAddr(addr)
+	}
+	switch t := pkt.(type) {
+	case *Message:
+		t.reply = reply
+	case *Bundle:
+		for _, m := range t.Messages {
+			setSource(m, addr, reply)
+		}
+		for _, b := range t.Bundles {
+			setSource(b, addr, reply)
+		}
+	}
+}
+
 // receivePacket receives an OSC packet from the given reader.
 func readPacket(reader *bufio.Reader, start *int, end int) (Packet, error) {
 	buf, err := reader.Peek(1)
@@ -48,8 +117,7 @@ func readPacket(reader *bufio.Reader, start *int, end int) (Packet, error) {
 		return pkt, nil
 	}
 
-	var pkt Packet
-	return pkt, nil
+	return nil, fmt.Errorf("%w: unknown first byte %q", errInvalidPacket, buf[0])
 }
 
 // readPaddedString reads a padded string from the given reader. The padding
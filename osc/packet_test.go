@@ -22,7 +22,18 @@ func TestParsePacket(t *testing.T) {
 			"/d/e/f" + nulls(2) + ",s" + nulls(2) + "foo" + nulls(1),
 			makePacket("/d/e/f", []string{"foo"}),
 			true},
+		{"blob_arg",
+			"/b" + nulls(2) + ",b" + nulls(2) + "\x00\x00\x00\x03abc" + nulls(1),
+			NewMessage("/b", []byte("abc")),
+			true},
 		{"empty", "", nil, false},
+		{"unknown_first_byte", "x/a" + nulls(1) + "," + nulls(3), nil, false},
+		{"no_type_tags", "/a" + nulls(2), nil, false},
+		{"empty_type_tags", "/a" + nulls(2) + nulls(4), nil, false},
+		{"truncated_timetag", "/a" + nulls(2) + ",t" + nulls(2) + nulls(4), nil, false},
+		{"negative_blob_length", "/a" + nulls(2) + ",b" + nulls(2) + "\xff\xff\xff\xff", nil, false},
+		{"huge_blob_length", "/a" + nulls(2) + ",b" + nulls(2) + "\x7f\xff\xff\xff", nil, false},
+		{"bundle_with_garbage", "#bundle" + nulls(1) + nulls(7) + "\x01" + "\x00\x00\x00\x04" + "x" + nulls(3), nil, false},
 	} {
 		pkt, err := ParsePacket(tt.msg)
 		if err != nil && tt.ok {
@@ -52,6 +63,30 @@ func TestParsePacket(t *testing.T) {
 	}
 }
 
+func TestDecodeErrorKind(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		data string
+		want string
+	}{
+		{"truncated address", "/abc", "truncated"},
+		{"truncated argument", "/a" + nulls(2) + ",i" + nulls(2) + "\x00\x01", "truncated"},
+		{"unknown first byte", "x", "unknown_packet"},
+		{"missing comma", "/a" + nulls(2) + "i" + nulls(3), "type_tag"},
+		{"unsupported type tag", "/a" + nulls(2) + ",x" + nulls(2), "type_tag"},
+		{"negative blob size", "/a" + nulls(2) + ",b" + nulls(2) + "\xff\xff\xff\xff", "malformed"},
+	} {
+		_, err := ParsePacket(tt.data)
+		if err == nil {
+			t.Errorf("%s: ParsePacket() expected error", tt.desc)
+			continue
+		}
+		if got := (&DecodeError{Err: err}).Kind(); got != tt.want {
+			t.Errorf("%s: Kind() = %q, want %q (error %v)", tt.desc, got, tt.want, err)
+		}
+	}
+}
+
 func TestReadPaddedString(t *testing.T) {
 	for _, tt := range []struct {
 		buf []byte // buffer
@@ -0,0 +1,222 @@
+package osc
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the histogram buckets for handler
+// durations and bundle lateness, in seconds.
+var latencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// PrometheusMetrics is a Metrics that keeps the measurements in memory and
+// serves them in the Prometheus text exposition format over HTTP:
+//
+//	m := osc.NewPrometheusMetrics()
+//	server, err := osc.NewServer(addr, osc.ServerMetrics(m))
+//	...
+//	http.Handle("/metrics", m)
+//
+// Messages that match no handler are counted without their address, as their
+// addresses are chosen by the senders.
+type PrometheusMetrics struct {
+	mu               sync.Mutex
+	packets          map[string]uint64 // By source.
+	bytes            map[string]uint64 // By source.
+	dropped          map[string]uint64 // By reason.
+	decodeErrors     map[string]uint64 // By kind.
+	dispatched       map[string]uint64 // By handler address.
+	unmatched        uint64
+	handlerDurations map[string]*histogram // By OSC address.
+	bundleLateness   histogram
+	queueDepth       int
+}
+
+// Verify that interfaces are implemented properly.
+var (
+	_ Metrics      = (*PrometheusMetrics)(nil)
+	_ http.Handler = (*PrometheusMetrics)(nil)
+)
+
+// NewPrometheusMetrics returns an empty PrometheusMetrics.
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		packets:          make(map[string]uint64),
+		bytes:            make(map[string]uint64),
+		dropped:          make(map[string]uint64),
+		decodeErrors:     make(map[string]uint64),
+		dispatched:       make(map[string]uint64),
+		handlerDurations: make(map[string]*histogram),
+		bundleLateness:   newHistogram(),
+	}
+}
+
+// PacketReceived implements the Metrics interface.
+func (m *PrometheusMetrics) PacketReceived(source string, size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.packets[source]++
+	m.bytes[source] += uint64(size)
+}
+
+// PacketDropped implements the Metrics interface.
+func (m *PrometheusMetrics) PacketDropped(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropped[reason]++
+}
+
+// DecodeFailed implements the Metrics interface.
+func (m *PrometheusMetrics) DecodeFailed(kind string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.decodeErrors[kind]++
+}
+
+// MessageDispatched implements the Metrics interface.
+func (m *PrometheusMetrics) MessageDispatched(address string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dispatched[address]++
+}
+
+// MessageUnmatched implements the Metrics interface.
+func (m *PrometheusMetrics) MessageUnmatched(string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unmatched++
+}
+
+// HandlerDone implements the Metrics interface.
+func (m *PrometheusMetrics) HandlerDone(address string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.handlerDurations[address]
+	if h == nil {
+		nh := newHistogram()
+		h = &nh
+		m.handlerDurations[address] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// BundleDue implements the Metrics interface.
+func (m *PrometheusMetrics) BundleDue(late time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bundleLateness.observe(late.Seconds())
+}
+
+// QueueDepth implements the Metrics interface.
+func (m *PrometheusMetrics) QueueDepth(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queueDepth = n
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	m.write(bw)
+	bw.Flush()
+}
+
+// write writes the metrics in the Prometheus text exposition format.
+func (m *PrometheusMetrics) write(w *bufio.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeHeader(w, "osc_packets_received_total", "counter", "Packets received, by source host.")
+	writeCounters(w, "osc_packets_received_total", "source", m.packets)
+	writeHeader(w, "osc_bytes_received_total", "counter", "Bytes received, by source host.")
+	writeCounters(w, "osc_bytes_received_total", "source", m.bytes)
+	writeHeader(w, "osc_packets_dropped_total", "counter", "Packets dropped before decoding, by reason.")
+	writeCounters(w, "osc_packets_dropped_total", "reason", m.dropped)
+	writeHeader(w, "osc_decode_errors_total", "counter", "Packets that could not be decoded, by kind of error.")
+	writeCounters(w, "osc_decode_errors_total", "kind", m.decodeErrors)
+	writeHeader(w, "osc_messages_dispatched_total", "counter", "Messages dispatched to handlers, by handler address.")
+	writeCounters(w, "osc_messages_dispatched_total", "address", m.dispatched)
+	writeHeader(w, "osc_messages_unmatched_total", "counter", "Messages that matched no handler.")
+	fmt.Fprintf(w, "osc_messages_unmatched_total %d\n", m.unmatched)
+
+	writeHeader(w, "osc_handler_duration_seconds", "histogram", "Time taken by handlers, by OSC address.")
+	for _, addr := range sortedKeys(m.handlerDurations) {
+		m.handlerDurations[addr].write(w, "osc_handler_duration_seconds", label("address", addr))
+	}
+	writeHeader(w, "osc_bundle_lateness_seconds", "histogram", "Time between the time tag of bundles and their dispatch.")
+	m.bundleLateness.write(w, "osc_bundle_lateness_seconds", "")
+	writeHeader(w, "osc_scheduled_bundles", "gauge", "Bundles waiting for the time of their time tag.")
+	fmt.Fprintf(w, "osc_scheduled_bundles %d\n", m.queueDepth)
+}
+
+func writeHeader(w *bufio.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeCounters(w *bufio.Writer, name, key string, values map[string]uint64) {
+	for _, k := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, label(key, k), values[k])
+	}
+}
+
+// label returns the label `key` with the value `value`, escaped as required
+// by the text exposition format.
+func label(key, value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return key + `="` + r.Replace(value) + `"`
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// histogram counts observations in the buckets of latencyBuckets.
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative.
+	count  uint64
+	sum    float64
+}
+
+func newHistogram() histogram {
+	return histogram{counts: make([]uint64, len(latencyBuckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	if i := sort.SearchFloat64s(latencyBuckets, v); i < len(latencyBuckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// write writes the histogram `name` with the labels `labels`, which may be
+// empty.
+func (h *histogram) write(w *bufio.Writer, name, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var cumulative uint64
+	for i, le := range latencyBuckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
@@ -0,0 +1,148 @@
+package osc
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	m := NewPrometheusMetrics()
+	m.PacketReceived("127.0.0.1", 16)
+	m.PacketReceived("127.0.0.1", 24)
+	m.PacketReceived("::1", 8)
+	m.PacketDropped("throttled")
+	m.DecodeFailed("truncated")
+	m.MessageDispatched(`/a"b\c`)
+	m.MessageUnmatched("/nobody")
+	m.MessageUnmatched("/nobody/else")
+	m.HandlerDone("/fader", 2*time.Millisecond)
+	m.HandlerDone("/fader", 10*time.Second)
+	m.BundleDue(0)
+	m.QueueDepth(3)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if got, want := w.Header().Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8"; got != want {
+		t.Errorf("Content-Type = %q, want %q", got, want)
+	}
+	body, err := io.ReadAll(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(string(body), "\n") {
+		lines[line] = true
+	}
+	for _, want := range []string{
+		"# TYPE osc_packets_received_total counter",
+		`osc_packets_received_total{source="127.0.0.1"} 2`,
+		`osc_packets_received_total{source="::1"} 1`,
+		`osc_bytes_received_total{source="127.0.0.1"} 40`,
+		`osc_packets_dropped_total{reason="throttled"} 1`,
+		`osc_decode_errors_total{kind="truncated"} 1`,
+		`osc_messages_dispatched_total{address="/a\"b\\c"} 1`,
+		"osc_messages_unmatched_total 2",
+		"# TYPE osc_handler_duration_seconds histogram",
+		`osc_handler_duration_seconds_bucket{address="/fader",le="0.001"} 0`,
+		`osc_handler_duration_seconds_bucket{address="/fader",le="0.005"} 1`,
+		`osc_handler_duration_seconds_bucket{address="/fader",le="5"} 1`,
+		`osc_handler_duration_seconds_bucket{address="/fader",le="+Inf"} 2`,
+		`osc_handler_duration_seconds_sum{address="/fader"} 10.002`,
+		`osc_handler_duration_seconds_count{address="/fader"} 2`,
+		`osc_bundle_lateness_seconds_bucket{le="0.0001"} 1`,
+		"osc_bundle_lateness_seconds_count 1",
+		"# TYPE osc_scheduled_bundles gauge",
+		"osc_scheduled_bundles 3",
+	} {
+		if !lines[want] {
+			t.Errorf("missing line %q in:\n%s", want, body)
+		}
+	}
+}
+
+// recordingMetrics is a Metrics that passes some of its measurements to
+// channels.
+type recordingMetrics struct {
+	nopMetrics
+	dispatched, unmatched, due chan string
+	depth                      chan int
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{
+		dispatched: make(chan string, 10),
+		unmatched:  make(chan string, 10),
+		due:        make(chan string, 10),
+		depth:      make(chan int, 10),
+	}
+}
+
+func (m *recordingMetrics) MessageDispatched(address string) { m.dispatched <- address }
+func (m *recordingMetrics) MessageUnmatched(address string)  { m.unmatched <- address }
+func (m *recordingMetrics) BundleDue(late time.Duration)     { m.due <- late.String() }
+func (m *recordingMetrics) QueueDepth(n int)                 { m.depth <- n }
+
+func TestDispatcherMetrics(t *testing.T) {
+	clock := NewFakeClock(fakeClockStart)
+	m := newRecordingMetrics()
+	d := NewOSCDispatcher()
+	d.SetClock(clock)
+	d.SetMetrics(m)
+	if err := d.AddMsgHandler("/ok", func(*Message) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	d.Dispatch(NewMessage("/o?"))
+	d.Dispatch(NewMessage("/unhandled"))
+	if got, want := <-m.dispatched, "/ok"; got != want {
+		t.Errorf("MessageDispatched(%q), want %q", got, want)
+	}
+	if got, want := <-m.unmatched, "/unhandled"; got != want {
+		t.Errorf("MessageUnmatched(%q), want %q", got, want)
+	}
+
+	late := NewBundle(fakeClockStart.Add(-time.Second))
+	late.Append(NewMessage("/ok"))
+	d.Dispatch(late)
+	if got, want := <-m.due, "1s"; got != want {
+		t.Errorf("BundleDue(%s), want %s", got, want)
+	}
+
+	later := NewBundle(fakeClockStart.Add(time.Second))
+	later.Append(NewMessage("/ok"))
+	d.Dispatch(later)
+	if got, want := <-m.depth, 1; got != want {
+		t.Errorf("QueueDepth(%d) after scheduling, want %d", got, want)
+	}
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	select {
+	case got := <-m.depth:
+		if want := 0; got != want {
+			t.Errorf("QueueDepth(%d) when due, want %d", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduled bundle not dispatched")
+	}
+	if got, want := <-m.due, "0s"; got != want {
+		t.Errorf("BundleDue(%s), want %s", got, want)
+	}
+}
+
+func TestSourceHost(t *testing.T) {
+	for _, tt := range []struct {
+		addr, want string
+	}{
+		{"127.0.0.1:9000", "127.0.0.1"},
+		{"[::1]:9000", "::1"},
+		{"/tmp/osc.sock", "/tmp/osc.sock"},
+		{"", ""},
+	} {
+		if got := sourceHost(tt.addr); got != tt.want {
+			t.Errorf("sourceHost(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
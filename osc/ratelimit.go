@@ -0,0 +1,251 @@
+package osc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// ErrRateLimiterClosed is returned by RateLimiter.Send after a call to Close.
+var ErrRateLimiterClosed = errors.New("rate limiter closed")
+
+// RateLimiter limits the rate of messages sent to each OSC address, for
+// example the updates of a motorized fader. Messages that arrive faster than
+// the limit are coalesced: only the latest value of an address is kept and
+// sent once the limit allows it, so the final value always arrives. Messages
+// to addresses set with RateLimiterNoCoalesce are queued instead.
+type RateLimiter struct {
+	sender   Sender
+	interval time.Duration // Minimum time between messages to an address.
+	opts     *rateLimiterOptions
+
+	mu      sync.Mutex
+	addrs   map[string]*rateState
+	sweepAt int // Size of addrs that triggers a sweep.
+	closed  bool
+}
+
+// Verify that interfaces are implemented properly.
+var _ Sender = (*RateLimiter)(nil)
+
+// rateState is the state of a single OSC address.
+type rateState struct {
+	last    time.Time  // Time the last message was sent.
+	pending []*Message // Messages not sent yet; only the latest if coalesced.
+	timer   Timer
+	gen     int // Generation of timer, to ignore timers stopped too late.
+}
+
+type rateLimiterOptions struct {
+	noCoalesce []*regexp.Regexp
+	onError    func(err error)
+	clock      Clock
+}
+
+// RateLimiterNoCoalesce turns off coalescing for the addresses matching the
+// OSC address pattern `v`, for example cues and button presses: every message
+// to them is sent, in order, while still being limited to the rate. Messages
+// that arrive faster than the rate are queued. It may be given several times.
+func RateLimiterNoCoalesce(v string) func(*rateLimiterOptions) error {
+	return func(o *rateLimiterOptions) error { return o.addNoCoalesce(v) }
+}
+
+func (o *rateLimiterOptions) addNoCoalesce(v string) error {
+	re, err := compileAddressPattern(v)
+	if err != nil {
+		return fmt.Errorf("invalid address pattern %q: %w", v, err)
+	}
+	o.noCoalesce = append(o.noCoalesce, re)
+	return nil
+}
+
+// RateLimiterOnError sets a function that is called with the errors of
+// coalesced messages, which are sent after Send has returned.
+func RateLimiterOnError(v func(err error)) func(*rateLimiterOptions) error {
+	return func(o *rateLimiterOptions) error { return o.setOnError(v) }
+}
+
+func (o *rateLimiterOptions) setOnError(v func(err error)) error {
+	o.onError = v
+	return nil
+}
+
+// RateLimiterClock sets the clock that the rate is measured with. The default
+// is SystemClock.
+func RateLimiterClock(v Clock) func(*rateLimiterOptions) error {
+	return func(o *rateLimiterOptions) error { return o.setClock(v) }
+}
+
+func (o *rateLimiterOptions) setClock(v Clock) error {
+	if v == nil {
+		return errors.New("nil clock")
+	}
+	o.clock = v
+	return nil
+}
+
+// NewRateLimiter returns a RateLimiter that sends at most `rate` messages per
+// second to each OSC address through `s`. The RateLimiter does not take
+// ownership of `s`.
+func NewRateLimiter(s Sender, rate float64, opts ...func(*rateLimiterOptions) error) (*RateLimiter, error) {
+	if !(rate > 0) || math.IsInf(rate, 1) {
+		return nil, fmt.Errorf("rate must be positive and finite: %g", rate)
+	}
+	o := &rateLimiterOptions{clock: SystemClock}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return &RateLimiter{
+		sender:   s,
+		interval: time.Duration(float64(time.Second) / rate),
+		opts:     o,
+		addrs:    make(map[string]*rateState),
+		sweepAt:  minSweepAt,
+	}, nil
+}
+
+// Send sends the Packet `pkt` if the rate limit of its address allows it, and
+// otherwise keeps it to be sent later in place of any older message to the
+// same address, or after them if the address is not coalesced. Bundles are
+// sent immediately.
+func (r *RateLimiter) Send(pkt Packet) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRateLimiterClosed
+	}
+	msg, ok := pkt.(*Message)
+	if !ok {
+		r.mu.Unlock()
+		return r.sender.Send(pkt)
+	}
+
+	now := r.opts.clock.Now()
+	st := r.addrs[msg.Address]
+	if st == nil {
+		if len(r.addrs) >= r.sweepAt {
+			r.sweep(now)
+		}
+		st = &rateState{}
+		r.addrs[msg.Address] = st
+	}
+	if len(st.pending) == 0 && now.Sub(st.last) >= r.interval {
+		st.last = now
+		r.mu.Unlock()
+		return r.sender.Send(msg)
+	}
+	if r.coalesces(msg.Address) {
+		st.pending = append(st.pending[:0], msg)
+	} else {
+		st.pending = append(st.pending, msg)
+	}
+	if st.timer == nil {
+		r.startTimer(st, st.last.Add(r.interval).Sub(now))
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// startTimer starts the timer that sends the next pending message of `st`
+// after `d`. The caller must hold r.mu.
+func (r *RateLimiter) startTimer(st *rateState, d time.Duration) {
+	st.gen++
+	gen := st.gen
+	st.timer = r.opts.clock.AfterFunc(d, func() { r.sendPending(st, gen) })
+}
+
+// Flush sends the pending messages of every address immediately.
+func (r *RateLimiter) Flush() error {
+	r.mu.Lock()
+	var msgs []*Message
+	now := r.opts.clock.Now()
+	for _, st := range r.addrs {
+		msgs = append(msgs, st.takePending(now)...)
+	}
+	r.mu.Unlock()
+
+	var err error
+	for _, msg := range msgs {
+		if serr := r.sender.Send(msg); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+// Close sends all pending messages and stops the RateLimiter. Packets sent
+// after Close are rejected with ErrRateLimiterClosed.
+func (r *RateLimiter) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	return r.Flush()
+}
+
+// coalesces returns true if only the latest pending message to `addr` is
+// kept.
+func (r *RateLimiter) coalesces(addr string) bool {
+	for _, re := range r.opts.noCoalesce {
+		if re.MatchString(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// sweep removes the states of the addresses that have no pending message and
+// whose interval has passed, as they are the same as new ones. The caller must
+// hold r.mu.
+func (r *RateLimiter) sweep(now time.Time) {
+	for addr, st := range r.addrs {
+		if len(st.pending) == 0 && st.timer == nil && now.Sub(st.last) >= r.interval {
+			delete(r.addrs, addr)
+		}
+	}
+	r.sweepAt = max(2*len(r.addrs), minSweepAt)
+}
+
+// sendPending sends the next pending message of `st` when its timer of
+// generation `gen` fires, and starts the timer again if more are queued.
+func (r *RateLimiter) sendPending(st *rateState, gen int) {
+	r.mu.Lock()
+	if st.timer == nil || st.gen != gen {
+		r.mu.Unlock()
+		return // Already sent by Flush.
+	}
+	st.timer = nil
+	if len(st.pending) == 0 {
+		r.mu.Unlock()
+		return
+	}
+	msg := st.pending[0]
+	st.pending = st.pending[1:]
+	st.last = r.opts.clock.Now()
+	if len(st.pending) > 0 {
+		r.startTimer(st, r.interval)
+	}
+	r.mu.Unlock()
+	if err := r.sender.Send(msg); err != nil && r.opts.onError != nil {
+		r.opts.onError(err)
+	}
+}
+
+// takePending returns the pending messages, if any, and records them as sent
+// at `now`. The caller must hold the lock of the RateLimiter.
+func (st *rateState) takePending(now time.Time) []*Message {
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	msgs := st.pending
+	if len(msgs) > 0 {
+		st.pending = nil
+		st.last = now
+	}
+	return msgs
+}
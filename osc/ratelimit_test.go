@@ -0,0 +1,196 @@
+package osc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// sent returns the packets recorded by `s` so far.
+func (s *recordingSender) sent() []Packet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Packet(nil), s.pkts...)
+}
+
+func TestRateLimiter(t *testing.T) {
+	s := &recordingSender{}
+	r, err := NewRateLimiter(s, 10, RateLimiterNoCoalesce("/cue/*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := int32(0); i < 100; i++ {
+		if err := r.Send(NewMessage("/fader/1", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Send(NewMessage("/fader/2", int32(7))); err != nil {
+		t.Fatal(err)
+	}
+	for i := int32(0); i < 3; i++ {
+		if err := r.Send(NewMessage("/cue/go", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first message to each address goes out at once, the final fader
+	// value and the other cues after the interval.
+	count := func(addr string) (n int, last interface{}) {
+		for _, pkt := range s.sent() {
+			if msg := pkt.(*Message); msg.Address == addr {
+				n, last = n+1, msg.Arguments[0]
+			}
+		}
+		return n, last
+	}
+	for _, tt := range []struct {
+		addr string
+		n    int
+		last int32
+	}{
+		{"/fader/1", 1, 0},
+		{"/fader/2", 1, 7},
+		{"/cue/go", 1, 0},
+	} {
+		if n, last := count(tt.addr); n != tt.n || last != tt.last {
+			t.Errorf("%s: sent %d messages, last %v; want %d, last %d", tt.addr, n, last, tt.n, tt.last)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if n, last := count("/fader/1"); n == 2 {
+			if last != int32(99) {
+				t.Errorf("final fader value = %v, want = 99", last)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for final fader value")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRateLimiterClose(t *testing.T) {
+	s := &recordingSender{}
+	r, err := NewRateLimiter(s, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int32(0); i < 3; i++ {
+		if err := r.Send(NewMessage("/fader/1", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	pkts := s.sent()
+	if got, want := len(pkts), 2; got != want {
+		t.Fatalf("sent %d messages, want = %d", got, want)
+	}
+	if got, want := pkts[1].(*Message).Arguments[0], int32(2); got != want {
+		t.Errorf("flushed value = %v, want = %v", got, want)
+	}
+	if err := r.Send(NewMessage("/fader/1")); !errors.Is(err, ErrRateLimiterClosed) {
+		t.Errorf("Send() after Close() = %v, want %v", err, ErrRateLimiterClosed)
+	}
+}
+
+func TestRateLimiterInvalidRate(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		rate float64
+	}{
+		{"zero", 0},
+		{"negative", -1},
+		{"NaN", math.NaN()},
+		{"infinite", math.Inf(1)},
+	} {
+		if _, err := NewRateLimiter(&recordingSender{}, tt.rate); err == nil {
+			t.Errorf("%s: NewRateLimiter(%g) expected error", tt.desc, tt.rate)
+		}
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	clock := NewFakeClock(fakeClockStart)
+	s := &recordingSender{}
+	r, err := NewRateLimiter(s, 10, RateLimiterClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	send := func(addr string) {
+		t.Helper()
+		if err := r.Send(NewMessage(addr)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < minSweepAt; i++ {
+		send(fmt.Sprintf("/fader/%d", i))
+	}
+	send("/fader/0") // Pending until the interval has passed.
+	clock.Advance(100 * time.Millisecond)
+	send("/fader/new")
+
+	// Only the address that was sent to last and /fader/new are kept.
+	r.mu.Lock()
+	got := len(r.addrs)
+	r.mu.Unlock()
+	if want := 2; got != want {
+		t.Errorf("kept the state of %d addresses, want %d", got, want)
+	}
+	if got, want := len(s.sent()), minSweepAt+2; got != want {
+		t.Errorf("sent %d messages, want %d", got, want)
+	}
+}
+
+func TestRateLimiterNoCoalesce(t *testing.T) {
+	clock := NewFakeClock(fakeClockStart)
+	s := &recordingSender{}
+	r, err := NewRateLimiter(s, 10, RateLimiterClock(clock), RateLimiterNoCoalesce("/cue/*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for i := int32(0); i < 3; i++ {
+		for _, addr := range []string{"/cue/go", "/fader"} {
+			if err := r.Send(NewMessage(addr, i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Every cue is sent, one per interval, while the fader is coalesced.
+	sent := 0
+	for _, tt := range []struct {
+		advance time.Duration
+		want    []string
+	}{
+		{0, []string{"/cue/go 0", "/fader 0"}},
+		{100 * time.Millisecond, []string{"/cue/go 1", "/fader 2"}},
+		{100 * time.Millisecond, []string{"/cue/go 2"}},
+		{100 * time.Millisecond, nil},
+	} {
+		clock.Advance(tt.advance)
+		pkts := s.sent()[sent:]
+		sent += len(pkts)
+		var got []string
+		for _, pkt := range pkts {
+			msg := pkt.(*Message)
+			got = append(got, fmt.Sprintf("%s %d", msg.Address, msg.Arguments[0]))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("after %s: sent %v, want %v", clock.Now().Sub(fakeClockStart), got, tt.want)
+		}
+	}
+}
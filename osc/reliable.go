@@ -0,0 +1,493 @@
+package osc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Reliable delivery wraps every packet in an envelope, a bundle with an
+// immediate timetag whose first element is the message
+//
+//	/reliable/seq ,ii <session> <sequence number>
+//
+// followed by the packet itself. The receiver acknowledges every envelope with
+//
+//	/reliable/ack ,ii <session> <sequence number>
+//
+// sent back to the source address, and dispatches each packet once. Senders
+// find out whether a peer supports the protocol by sending /reliable/hello,
+// which supporting peers answer with /reliable/hello.
+const (
+	reliableHelloAddr = "/reliable/hello"
+	reliableSeqAddr   = "/reliable/seq"
+	reliableAckAddr   = "/reliable/ack"
+)
+
+// ErrNotDelivered is reported for packets that were not acknowledged by the
+// peer before the retransmissions ran out or the ReliableClient was closed.
+var ErrNotDelivered = errors.New("packet not acknowledged")
+
+// ReliableClient sends packets over a datagram Client and retransmits them
+// until the peer acknowledges them, for cues that must not get lost. The peer
+// must be a Server with the ServerReliable option, which acknowledges packets
+// and drops duplicates. Peers without support receive plain packets, see
+// ReliablePeer. Packets sent reliably are not traced, as the peer only
+// recognizes an envelope that is not wrapped in another bundle.
+type ReliableClient struct {
+	client  *Client
+	opts    *reliableOptions
+	session int32
+	stop    func() // Stops watching for acks.
+
+	negotiate sync.Mutex // Held while negotiating.
+
+	mu       sync.Mutex
+	peer     reliablePeer
+	seq      int32
+	inflight map[int32]*inflight
+	closed   bool
+}
+
+// Verify that interfaces are implemented properly.
+var _ Sender = (*ReliableClient)(nil)
+
+// reliablePeer is what is known about the peer of a ReliableClient.
+type reliablePeer int
+
+const (
+	peerUnknown reliablePeer = iota
+	peerReliable
+	peerPlain
+)
+
+// inflight is a packet waiting for its acknowledgement.
+type inflight struct {
+	pkt     Packet
+	data    []byte // Encoded envelope.
+	retries int
+	timeout time.Duration
+	timer   Timer
+	done    chan error // Receives the outcome for Deliver; nil for Send.
+}
+
+type reliableOptions struct {
+	timeout          time.Duration
+	retries          int
+	peer             reliablePeer
+	negotiateTimeout time.Duration
+	onDelivery       func(pkt Packet, err error)
+}
+
+// ReliableTimeout sets how long to wait for an acknowledgement before the
+// first retransmission. The timeout doubles with every retransmission. The
+// default is 100ms.
+func ReliableTimeout(v time.Duration) func(*reliableOptions) error {
+	return func(o *reliableOptions) error { return o.setTimeout(v) }
+}
+
+func (o *reliableOptions) setTimeout(v time.Duration) error {
+	if v <= 0 {
+		return fmt.Errorf("timeout must be positive: %s", v)
+	}
+	o.timeout = v
+	return nil
+}
+
+// ReliableRetries sets how often a packet is retransmitted before it is
+// reported as not delivered. The default is 5.
+func ReliableRetries(v int) func(*reliableOptions) error {
+	return func(o *reliableOptions) error { return o.setRetries(v) }
+}
+
+func (o *reliableOptions) setRetries(v int) error {
+	if v < 0 {
+		return fmt.Errorf("negative retries: %d", v)
+	}
+	o.retries = v
+	return nil
+}
+
+// ReliablePeer configures whether the peer supports reliable delivery instead
+// of asking it. If false, packets are sent plainly, once, and delivery is not
+// reported. By default, the peer is asked with the first packet sent, see
+// Negotiate.
+func ReliablePeer(v bool) func(*reliableOptions) error {
+	return func(o *reliableOptions) error { return o.setPeer(v) }
+}
+
+func (o *reliableOptions) setPeer(v bool) error {
+	o.peer = peerPlain
+	if v {
+		o.peer = peerReliable
+	}
+	return nil
+}
+
+// ReliableNegotiateTimeout sets how long to wait for the peer to confirm that
+// it supports reliable delivery, each time it is asked. The default is 500ms.
+func ReliableNegotiateTimeout(v time.Duration) func(*reliableOptions) error {
+	return func(o *reliableOptions) error { return o.setNegotiateTimeout(v) }
+}
+
+func (o *reliableOptions) setNegotiateTimeout(v time.Duration) error {
+	if v <= 0 {
+		return fmt.Errorf("negotiate timeout must be positive: %s", v)
+	}
+	o.negotiateTimeout = v
+	return nil
+}
+
+// ReliableOnDelivery sets a function that is called once for every packet
+// sent with Send to a reliable peer, with a nil error when the packet is
+// acknowledged and ErrNotDelivered when it is not.
+func ReliableOnDelivery(v func(pkt Packet, err error)) func(*reliableOptions) error {
+	return func(o *reliableOptions) error { return o.setOnDelivery(v) }
+}
+
+func (o *reliableOptions) setOnDelivery(v func(pkt Packet, err error)) error {
+	o.onDelivery = v
+	return nil
+}
+
+// NewReliableClient returns a ReliableClient that sends through `c`, which
+// must be able to receive acknowledgements, see Client.Handle. The
+// ReliableClient does not take ownership of `c`.
+func NewReliableClient(c *Client, opts ...func(*reliableOptions) error) (*ReliableClient, error) {
+	o := &reliableOptions{
+		timeout:          100 * time.Millisecond,
+		retries:          5,
+		negotiateTimeout: 500 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	r := &ReliableClient{
+		client:   c,
+		opts:     o,
+		session:  rand.Int31(),
+		peer:     o.peer,
+		inflight: make(map[int32]*inflight),
+	}
+	stop, err := c.watch(reliableAckAddr, func(msg *Message) bool {
+		r.acknowledge(msg)
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.stop = stop
+	return r, nil
+}
+
+// reliableHelloAttempts is how often a peer is asked whether it supports
+// reliable delivery before it is assumed not to.
+const reliableHelloAttempts = 3
+
+// Negotiate asks the peer whether it supports reliable delivery, unless this
+// is already known, and returns the answer. The question is repeated if the
+// peer does not answer within the negotiation timeout, as it may have been
+// lost; peers that do not answer at all are sent plain packets from then on.
+func (r *ReliableClient) Negotiate(ctx context.Context) (bool, error) {
+	r.negotiate.Lock()
+	defer r.negotiate.Unlock()
+
+	r.mu.Lock()
+	peer := r.peer
+	r.mu.Unlock()
+	if peer != peerUnknown {
+		return peer == peerReliable, nil
+	}
+
+	peer = peerPlain
+	for i := 0; i < reliableHelloAttempts && peer == peerPlain; i++ {
+		hctx, cancel := context.WithTimeout(ctx, r.opts.negotiateTimeout)
+		_, err := r.client.Request(hctx, NewMessage(reliableHelloAddr), reliableHelloAddr)
+		cancel()
+		switch {
+		case err == nil:
+			peer = peerReliable
+		case ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded):
+			// Ask again.
+		default:
+			return false, err
+		}
+	}
+	r.mu.Lock()
+	r.peer = peer
+	r.mu.Unlock()
+	return peer == peerReliable, nil
+}
+
+// Send sends the Packet `pkt` and returns once it has been sent the first
+// time. The outcome is reported to the function set with ReliableOnDelivery.
+func (r *ReliableClient) Send(pkt Packet) error {
+	_, err := r.send(context.Background(), pkt, nil)
+	return err
+}
+
+// Deliver sends the Packet `pkt` and waits until the peer acknowledges it. It
+// returns ErrNotDelivered if the retransmissions run out, and the error of
+// `ctx` if it is done first. For peers without reliable delivery, Deliver
+// returns once the packet has been sent.
+func (r *ReliableClient) Deliver(ctx context.Context, pkt Packet) error {
+	done := make(chan error, 1)
+	seq, err := r.send(ctx, pkt, done)
+	if err != nil || seq == 0 {
+		return err
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		r.mu.Lock()
+		if f := r.inflight[seq]; f != nil {
+			f.timer.Stop()
+			delete(r.inflight, seq)
+		}
+		r.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// send sends `pkt` and returns its sequence number, which is zero if the peer
+// does not support reliable delivery.
+func (r *ReliableClient) send(ctx context.Context, pkt Packet, done chan error) (int32, error) {
+	reliable, err := r.Negotiate(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !reliable {
+		return 0, r.client.SendContext(ctx, pkt)
+	}
+	data, err := pkt.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return 0, ErrNotDelivered
+	}
+	r.seq++ // Wraps around; receivers compare sequence numbers serially.
+	if r.seq == 0 {
+		r.seq = 1 // Zero means not sent reliably.
+	}
+	seq := r.seq
+	header, err := NewMessage(reliableSeqAddr, r.session, seq).MarshalBinary()
+	if err != nil {
+		r.mu.Unlock()
+		return 0, err
+	}
+	f := &inflight{
+		pkt:     pkt,
+		data:    encodeBundle(Immediate, [][]byte{header, data}),
+		timeout: r.opts.timeout,
+		done:    done,
+	}
+	r.inflight[seq] = f
+	f.timer = r.client.clock().AfterFunc(f.timeout, func() { r.retransmit(seq, f) })
+	r.mu.Unlock()
+
+	if err := r.client.sendRaw(ctx, f.data); err != nil {
+		r.mu.Lock()
+		f.timer.Stop()
+		delete(r.inflight, seq)
+		r.mu.Unlock()
+		return 0, err
+	}
+	return seq, nil
+}
+
+// retransmit sends the packet `f` again if it is still unacknowledged, or
+// gives up on it.
+func (r *ReliableClient) retransmit(seq int32, f *inflight) {
+	r.mu.Lock()
+	if r.inflight[seq] != f {
+		r.mu.Unlock()
+		return // Acknowledged in the meantime.
+	}
+	if f.retries >= r.opts.retries {
+		delete(r.inflight, seq)
+		r.mu.Unlock()
+		r.report(f, ErrNotDelivered)
+		return
+	}
+	f.retries++
+	f.timeout *= 2
+	f.timer = r.client.clock().AfterFunc(f.timeout, func() { r.retransmit(seq, f) })
+	r.mu.Unlock()
+
+	// Errors are handled like lost packets.
+	r.client.sendRaw(context.Background(), f.data)
+}
+
+// acknowledge handles the acknowledgement `msg`.
+func (r *ReliableClient) acknowledge(msg *Message) {
+	if len(msg.Arguments) != 2 {
+		return
+	}
+	session, ok1 := msg.Arguments[0].(int32)
+	seq, ok2 := msg.Arguments[1].(int32)
+	if !ok1 || !ok2 || session != r.session {
+		return
+	}
+	r.mu.Lock()
+	f := r.inflight[seq]
+	if f == nil {
+		r.mu.Unlock()
+		return // Duplicate acknowledgement.
+	}
+	f.timer.Stop()
+	delete(r.inflight, seq)
+	r.mu.Unlock()
+	r.report(f, nil)
+}
+
+// report reports the outcome `err` of sending `f`.
+func (r *ReliableClient) report(f *inflight, err error) {
+	if f.done != nil {
+		f.done <- err
+		return
+	}
+	if r.opts.onDelivery != nil {
+		r.opts.onDelivery(f.pkt, err)
+	}
+}
+
+// Close stops retransmitting and reports all unacknowledged packets as not
+// delivered. It does not close the Client.
+func (r *ReliableClient) Close() error {
+	r.stop()
+	r.mu.Lock()
+	r.closed = true
+	pending := r.inflight
+	r.inflight = make(map[int32]*inflight)
+	r.mu.Unlock()
+
+	for _, f := range pending {
+		f.timer.Stop()
+		r.report(f, ErrNotDelivered)
+	}
+	return nil
+}
+
+// reliableSessionTTL is how long a receiver remembers a sender's session
+// after its last packet.
+const reliableSessionTTL = time.Minute
+
+// reliableWindow is how many sequence numbers below the highest one received
+// a receiver remembers to detect duplicates.
+const reliableWindow = 1024
+
+// reliableReceiver acknowledges envelopes and drops duplicates for a Server.
+type reliableReceiver struct {
+	clock    Clock
+	logger   *slog.Logger
+	mu       sync.Mutex
+	sessions map[reliableSessionKey]*reliableSession
+}
+
+type reliableSessionKey struct {
+	addr    string
+	session int32
+}
+
+// reliableSession is the state of a single sender's session. Sequence numbers
+// wrap around, so they are compared by their difference, see RFC 1982.
+type reliableSession struct {
+	highest  int32              // Latest sequence number received.
+	seen     map[int32]struct{} // Sequence numbers within the window.
+	lastSeen time.Time
+}
+
+func newReliableReceiver(clock Clock, logger *slog.Logger) *reliableReceiver {
+	return &reliableReceiver{clock: clock, logger: logger, sessions: make(map[reliableSessionKey]*reliableSession)}
+}
+
+// accept handles the reliable delivery protocol for the received packet
+// `pkt`. It returns the packet to dispatch, or false if there is none.
+func (r *reliableReceiver) accept(pkt Packet) (Packet, bool) {
+	switch p := pkt.(type) {
+	case *Message:
+		if p.Address == reliableHelloAddr {
+			p.Reply(NewMessage(reliableHelloAddr))
+			return nil, false
+		}
+		return pkt, true
+	case *Bundle:
+		if len(p.Messages) == 0 || p.Messages[0].Address != reliableSeqAddr {
+			return pkt, true
+		}
+		header := p.Messages[0]
+		if len(header.Arguments) != 2 {
+			r.logger.Warn("dropped malformed reliable envelope", "source", p.Addr())
+			return nil, false
+		}
+		session, ok1 := header.Arguments[0].(int32)
+		seq, ok2 := header.Arguments[1].(int32)
+		if !ok1 || !ok2 {
+			r.logger.Warn("dropped malformed reliable envelope", "source", p.Addr())
+			return nil, false
+		}
+		header.Reply(NewMessage(reliableAckAddr, session, seq))
+		if !r.isNew(reliableSessionKey{p.Addr(), session}, seq) {
+			r.logger.Debug("dropped duplicate packet", "source", p.Addr(), "session", session, "seq", seq)
+			return nil, false
+		}
+		switch {
+		case len(p.Messages) == 2 && len(p.Bundles) == 0:
+			return p.Messages[1], true
+		case len(p.Messages) == 1 && len(p.Bundles) == 1:
+			return p.Bundles[0], true
+		}
+		r.logger.Warn("dropped malformed reliable envelope", "source", p.Addr())
+		return nil, false
+	}
+	return pkt, true
+}
+
+// isNew records `seq` for the session `key` and returns true if it has not
+// been received before.
+func (r *reliableReceiver) isNew(key reliableSessionKey, seq int32) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.clock.Now()
+	s := r.sessions[key]
+	if s == nil {
+		for k, old := range r.sessions {
+			if now.Sub(old.lastSeen) > reliableSessionTTL {
+				delete(r.sessions, k)
+			}
+		}
+		s = &reliableSession{highest: seq, seen: make(map[int32]struct{})}
+		r.sessions[key] = s
+	}
+	s.lastSeen = now
+
+	if seq-s.highest <= -reliableWindow {
+		return false // Too old to tell; assume a duplicate.
+	}
+	if _, ok := s.seen[seq]; ok {
+		return false
+	}
+	s.seen[seq] = struct{}{}
+	if seq-s.highest > 0 {
+		s.highest = seq
+	}
+	if len(s.seen) > 2*reliableWindow {
+		for old := range s.seen {
+			if old-s.highest <= -reliableWindow {
+				delete(s.seen, old)
+			}
+		}
+	}
+	return true
+}
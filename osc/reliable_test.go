@@ -0,0 +1,263 @@
+package osc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lossyConn is a net.PacketConn that drops every other packet it writes, or
+// writes every packet twice.
+type lossyConn struct {
+	net.PacketConn
+	dup bool
+
+	mu     sync.Mutex
+	writes int
+}
+
+func (c *lossyConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	c.writes++
+	drop := !c.dup && c.writes%2 == 1
+	c.mu.Unlock()
+	if drop {
+		return len(p), nil
+	}
+	if c.dup {
+		if _, err := c.PacketConn.WriteTo(p, addr); err != nil {
+			return 0, err
+		}
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+// startReliableServer starts a server with reliable delivery that counts the
+// /cue messages it receives by their argument.
+func startReliableServer(t *testing.T, reliable bool) (string, func() map[int32]int) {
+	t.Helper()
+	server, err := NewServer("", ServerReliable(reliable))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	cues := make(map[int32]int)
+	if err := server.Handle("/cue", func(msg *Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		cues[msg.Arguments[0].(int32)]++
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return startServer(t, server), func() map[int32]int {
+		mu.Lock()
+		defer mu.Unlock()
+		c := make(map[int32]int, len(cues))
+		for k, v := range cues {
+			c[k] = v
+		}
+		return c
+	}
+}
+
+func TestReliableClient(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		dup  bool
+	}{
+		{"lossy", false},
+		{"duplicating", true},
+	} {
+		addr, received := startReliableServer(t, true)
+		raddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn := &lossyConn{PacketConn: listenUDP(t), dup: tt.dup}
+		r, err := NewReliableClient(NewClientConn(conn, raddr), ReliablePeer(true), ReliableTimeout(20*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for i := int32(0); i < 5; i++ {
+			if err := r.Deliver(ctx, NewMessage("/cue", i)); err != nil {
+				t.Fatalf("%s: Deliver(%d) unexpected error; %s", tt.desc, i, err)
+			}
+		}
+		// Give duplicates time to arrive.
+		time.Sleep(100 * time.Millisecond)
+		cues := received()
+		for i := int32(0); i < 5; i++ {
+			if got, want := cues[i], 1; got != want {
+				t.Errorf("%s: cue %d received %d times, want = %d", tt.desc, i, got, want)
+			}
+		}
+	}
+}
+
+func TestReliableClientNegotiate(t *testing.T) {
+	for _, tt := range []struct {
+		desc     string
+		reliable bool
+	}{
+		{"reliable peer", true},
+		{"plain peer", false},
+	} {
+		addr, received := startReliableServer(t, tt.reliable)
+		client, err := Dial("udp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		r, err := NewReliableClient(client, ReliableNegotiateTimeout(200*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		ok, err := r.Negotiate(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Negotiate() unexpected error; %s", tt.desc, err)
+		}
+		if got, want := ok, tt.reliable; got != want {
+			t.Errorf("%s: Negotiate() = %t, want = %t", tt.desc, got, want)
+		}
+		if err := r.Deliver(context.Background(), NewMessage("/cue", int32(1))); err != nil {
+			t.Fatalf("%s: Deliver() unexpected error; %s", tt.desc, err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for received()[1] != 1 {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: cue not received", tt.desc)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestReliableClientNotDelivered(t *testing.T) {
+	// The peer never acknowledges anything.
+	peer := listenUDP(t)
+	client, err := Dial("udp", peer.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	delivered := make(chan error, 2)
+	r, err := NewReliableClient(client,
+		ReliablePeer(true),
+		ReliableTimeout(10*time.Millisecond),
+		ReliableRetries(2),
+		ReliableOnDelivery(func(pkt Packet, err error) { delivered <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Deliver(context.Background(), NewMessage("/cue", int32(1))); !errors.Is(err, ErrNotDelivered) {
+		t.Errorf("Deliver() = %v, want %v", err, ErrNotDelivered)
+	}
+	if err := r.Send(NewMessage("/cue", int32(2))); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-delivered:
+		if !errors.Is(err, ErrNotDelivered) {
+			t.Errorf("delivery = %v, want %v", err, ErrNotDelivered)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for delivery callback")
+	}
+
+	// Close reports the packets still in flight.
+	if err := r.Send(NewMessage("/cue", int32(3))); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if err := <-delivered; !errors.Is(err, ErrNotDelivered) {
+		t.Errorf("delivery after Close() = %v, want %v", err, ErrNotDelivered)
+	}
+}
+
+func TestReliableClientNegotiateLostHello(t *testing.T) {
+	addr, _ := startReliableServer(t, true)
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first hello is dropped.
+	conn := &lossyConn{PacketConn: listenUDP(t)}
+	r, err := NewReliableClient(NewClientConn(conn, raddr), ReliableNegotiateTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ok, err := r.Negotiate(context.Background())
+	if err != nil {
+		t.Fatalf("Negotiate() unexpected error; %s", err)
+	}
+	if !ok {
+		t.Error("Negotiate() = false after a lost hello, want true")
+	}
+}
+
+func TestReliableClientSequenceWrap(t *testing.T) {
+	addr, received := startReliableServer(t, true)
+	client, err := Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	r, err := NewReliableClient(client, ReliablePeer(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.seq = math.MaxInt32 - 2
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := int32(0); i < 5; i++ {
+		if err := r.Deliver(ctx, NewMessage("/cue", i)); err != nil {
+			t.Fatalf("Deliver(%d) unexpected error; %s", i, err)
+		}
+	}
+	cues := received()
+	for i := int32(0); i < 5; i++ {
+		if got, want := cues[i], 1; got != want {
+			t.Errorf("cue %d received %d times, want = %d", i, got, want)
+		}
+	}
+}
+
+func TestReliableReceiverWrap(t *testing.T) {
+	r := newReliableReceiver(NewFakeClock(fakeClockStart), discardLogger)
+	key := reliableSessionKey{"127.0.0.1:9000", 1}
+	for _, tt := range []struct {
+		seq  int32
+		want bool
+	}{
+		{math.MaxInt32 - 1, true},
+		{math.MaxInt32, true},
+		{math.MinInt32, true},
+		{math.MinInt32 + 1, true},
+		{math.MaxInt32, false},
+		{math.MinInt32, false},
+		{math.MaxInt32 - reliableWindow, false},
+		{-1, true}, // Far ahead, as if many packets were lost.
+		{1, true},  // Zero is skipped.
+		{math.MinInt32 + 2, false},
+	} {
+		if got := r.isNew(key, tt.seq); got != tt.want {
+			t.Errorf("isNew(%d) = %t, want %t", tt.seq, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package osc
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// scheduler calls functions at their scheduled times on a Clock. The
+// functions are kept in a priority queue and called one at a time, in time
+// order, from a single goroutine that runs while functions are scheduled.
+// Functions scheduled for the same time are called in the order they were
+// scheduled.
+type scheduler struct {
+	clock Clock
+	wake  chan struct{} // Signaled when an earlier function is scheduled.
+
+	mu      sync.Mutex
+	queue   scheduleQueue
+	seq     uint64
+	running bool
+}
+
+func newScheduler(clock Clock) *scheduler {
+	return &scheduler{clock: clock, wake: make(chan struct{}, 1)}
+}
+
+// schedule calls `fn` at the time `at`, or as soon as possible if `at` has
+// passed. The returned item can be given to cancel.
+func (s *scheduler) schedule(at time.Time, fn func()) *scheduledFunc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	item := &scheduledFunc{at: at, seq: s.seq, fn: fn}
+	heap.Push(&s.queue, item)
+	if !s.running {
+		s.running = true
+		go s.run()
+	} else if s.queue[0] == item {
+		s.wakeUp()
+	}
+	return item
+}
+
+// cancel removes `item` from the queue. It returns false if the function has
+// already been called or cancelled.
+func (s *scheduler) cancel(item *scheduledFunc) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if item.index < 0 {
+		return false
+	}
+	heap.Remove(&s.queue, item.index)
+	return true
+}
+
+// shift moves all functions in the queue by `d`, which keeps their order.
+func (s *scheduler) shift(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range s.queue {
+		item.at = item.at.Add(d)
+	}
+	if s.running {
+		s.wakeUp()
+	}
+}
+
+// clear removes all functions from the queue.
+func (s *scheduler) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range s.queue {
+		item.index = -1
+	}
+	s.queue = nil
+	if s.running {
+		s.wakeUp()
+	}
+}
+
+// len returns the number of functions in the queue.
+func (s *scheduler) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// wakeUp makes the goroutine check the queue again. The caller must hold s.mu.
+func (s *scheduler) wakeUp() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run calls the scheduled functions when they are due, until the queue is
+// empty.
+func (s *scheduler) run() {
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.running = false
+			s.mu.Unlock()
+			return
+		}
+		next := s.queue[0]
+		d := next.at.Sub(s.clock.Now())
+		if d <= 0 {
+			heap.Pop(&s.queue)
+			s.mu.Unlock()
+			next.fn()
+			continue
+		}
+		// The clock is checked again after waiting, as it may have been set
+		// back in the meantime.
+		timer := s.clock.NewTimer(d)
+		s.mu.Unlock()
+		select {
+		case <-timer.C():
+		case <-s.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// scheduledFunc is a function in the queue of a scheduler.
+type scheduledFunc struct {
+	at    time.Time
+	seq   uint64 // Orders functions scheduled for the same time.
+	fn    func()
+	index int // Index in the queue, or -1 once removed.
+}
+
+// scheduleQueue is a min-heap of scheduled functions ordered by time. It
+// implements heap.Interface.
+type scheduleQueue []*scheduledFunc
+
+func (q scheduleQueue) Len() int { return len(q) }
+
+func (q scheduleQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at.Before(q[j].at)
+}
+
+func (q scheduleQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *scheduleQueue) Push(x any) {
+	item := x.(*scheduledFunc)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *scheduleQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*q = old[:n-1]
+	return item
+}
@@ -0,0 +1,138 @@
+package osc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// ErrPacketTooLarge is returned, wrapped in a SendError, for packets that do
+// not fit in a single datagram.
+var ErrPacketTooLarge = errors.New("packet too large")
+
+// maxUDPPayload is the largest payload of a UDP datagram over IPv4: 65535
+// bytes less the 20-byte IPv4 header and the 8-byte UDP header.
+const maxUDPPayload = 65507
+
+// dataSender is implemented by senders that can send an encoded packet, which
+// lets MultiClient encode a packet once for all destinations.
+type dataSender interface {
+	sendData(ctx context.Context, data []byte) error
+}
+
+// Verify that interfaces are implemented properly.
+var (
+	_ dataSender = (*Client)(nil)
+	_ dataSender = (*StreamClient)(nil)
+)
+
+// SendPhase is the step of sending a packet that failed.
+type SendPhase int
+
+const (
+	// SendPhaseMarshal is encoding the packet.
+	SendPhaseMarshal SendPhase = iota
+	// SendPhaseResolve is resolving the destination address.
+	SendPhaseResolve
+	// SendPhaseDial is opening a socket to the destination.
+	SendPhaseDial
+	// SendPhaseSize is checking that the packet fits in a datagram.
+	SendPhaseSize
+	// SendPhaseWrite is writing the packet to the socket.
+	SendPhaseWrite
+)
+
+// String implements the fmt.Stringer interface.
+func (p SendPhase) String() string {
+	switch p {
+	case SendPhaseMarshal:
+		return "marshal"
+	case SendPhaseResolve:
+		return "resolve"
+	case SendPhaseDial:
+		return "dial"
+	case SendPhaseSize:
+		return "size"
+	case SendPhaseWrite:
+		return "write"
+	}
+	return fmt.Sprintf("SendPhase(%d)", int(p))
+}
+
+// SendError is the error returned by Client.Send and Client.SendContext. Use
+// errors.Is to test for the underlying cause, for example ErrPacketTooLarge,
+// net.ErrClosed or context.DeadlineExceeded.
+type SendError struct {
+	Phase SendPhase // Step that failed.
+	Addr  string    // Destination of the packet, if known.
+	Err   error     // Underlying error.
+}
+
+func (e *SendError) Error() string {
+	if e.Addr == "" {
+		return fmt.Sprintf("%s: %v", e.Phase, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Phase, e.Addr, e.Err)
+}
+
+func (e *SendError) Unwrap() error { return e.Err }
+
+// checkDatagramSize returns an error if a datagram of `n` bytes to `raddr`
+// does not fit in a single UDP datagram, or, if `mtu` is positive, in a single
+// unfragmented IP packet. Other networks are not checked.
+func checkDatagramSize(raddr net.Addr, n, mtu int) error {
+	ua, ok := raddr.(*net.UDPAddr)
+	if !ok {
+		return nil
+	}
+	limit := maxUDPPayload
+	if mtu > 0 {
+		header := 28 // IPv4 and UDP headers.
+		if ua.IP.To4() == nil {
+			header = 48 // IPv6 and UDP headers.
+		}
+		limit = min(limit, mtu-header)
+	}
+	if n > limit {
+		return fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes", ErrPacketTooLarge, n, limit)
+	}
+	return nil
+}
+
+// contextError returns the error of `ctx` if `err` is the result of `ctx`
+// being done or its deadline passing, and `err` otherwise.
+func contextError(ctx context.Context, err error) error {
+	if cerr := ctx.Err(); cerr != nil {
+		return cerr
+	}
+	if _, ok := ctx.Deadline(); ok && errors.Is(err, os.ErrDeadlineExceeded) {
+		return context.DeadlineExceeded // The write deadline fired first.
+	}
+	return err
+}
+
+// applyWriteDeadline applies the deadline and cancellation of `ctx` to writes
+// on `v` until the returned stop function is called, which also clears the
+// write deadline again.
+func applyWriteDeadline(ctx context.Context, v interface{}) (stop func()) {
+	d, ok := v.(interface{ SetWriteDeadline(time.Time) error })
+	if !ok {
+		return func() {}
+	}
+	t, _ := ctx.Deadline()
+	d.SetWriteDeadline(t)
+	fired := make(chan struct{})
+	release := context.AfterFunc(ctx, func() {
+		d.SetWriteDeadline(time.Now())
+		close(fired)
+	})
+	return func() {
+		if !release() {
+			<-fired // Don't let the callback run after the deadline is cleared.
+		}
+		d.SetWriteDeadline(time.Time{})
+	}
+}
@@ -0,0 +1,129 @@
+package osc
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrSendSchedulerClosed is returned by SendScheduler.Schedule after a call to
+// Close.
+var ErrSendSchedulerClosed = errors.New("send scheduler closed")
+
+// SendScheduler holds packets and sends each of them when the time of its
+// time tag comes, for receivers that do not honour the time tags of bundles.
+// Packets are sent one at a time, in time tag order, from a single goroutine;
+// packets with the same time tag are sent in the order they were scheduled.
+type SendScheduler struct {
+	sender Sender
+	opts   *sendSchedulerOptions
+	sched  *scheduler
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// ScheduledSend is the handle of a packet held by a SendScheduler.
+type ScheduledSend struct {
+	sched *scheduler
+	item  *scheduledFunc
+}
+
+// Cancel removes the packet from the queue of the SendScheduler. It returns
+// false if the packet has already been sent or cancelled.
+func (h *ScheduledSend) Cancel() bool {
+	return h.sched.cancel(h.item)
+}
+
+type sendSchedulerOptions struct {
+	clock   Clock
+	onError func(err error)
+}
+
+// SendSchedulerClock sets the clock that packets are sent by, for example the
+// Clock of a TimeSync to send in the time of the receiver. The default is
+// SystemClock.
+func SendSchedulerClock(v Clock) func(*sendSchedulerOptions) error {
+	return func(o *sendSchedulerOptions) error { return o.setClock(v) }
+}
+
+func (o *sendSchedulerOptions) setClock(v Clock) error {
+	if v == nil {
+		return errors.New("nil clock")
+	}
+	o.clock = v
+	return nil
+}
+
+// SendSchedulerOnError sets a function that is called with the errors of
+// scheduled packets, which are sent after Schedule has returned.
+func SendSchedulerOnError(v func(err error)) func(*sendSchedulerOptions) error {
+	return func(o *sendSchedulerOptions) error { return o.setOnError(v) }
+}
+
+func (o *sendSchedulerOptions) setOnError(v func(err error)) error {
+	o.onError = v
+	return nil
+}
+
+// NewSendScheduler returns a SendScheduler that sends packets through `s`. The
+// SendScheduler does not take ownership of `s`.
+func NewSendScheduler(s Sender, opts ...func(*sendSchedulerOptions) error) (*SendScheduler, error) {
+	o := &sendSchedulerOptions{clock: SystemClock}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return &SendScheduler{
+		sender: s,
+		opts:   o,
+		sched:  newScheduler(o.clock),
+	}, nil
+}
+
+// Schedule holds the Packet `pkt` until the time of `tt` and then sends it.
+// Packets whose time tag is Immediate or has passed are sent as soon as
+// possible, after the packets that are already due. The packet is sent as it
+// is; the time tag of a bundle is not changed.
+func (s *SendScheduler) Schedule(tt Timetag, pkt Packet) (*ScheduledSend, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrSendSchedulerClosed
+	}
+	at := tt.Time()
+	if tt.IsImmediate() {
+		at = s.opts.clock.Now()
+	}
+	item := s.sched.schedule(at, func() { s.send(pkt) })
+	return &ScheduledSend{sched: s.sched, item: item}, nil
+}
+
+// Shift moves the time of all held packets by `d`, for example to follow a
+// change of tempo. Packets moved into the past are sent immediately.
+func (s *SendScheduler) Shift(d time.Duration) {
+	s.sched.shift(d)
+}
+
+// Len returns the number of packets held.
+func (s *SendScheduler) Len() int {
+	return s.sched.len()
+}
+
+// Close drops all held packets and stops the SendScheduler. Packets scheduled
+// after Close are rejected with ErrSendSchedulerClosed.
+func (s *SendScheduler) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.sched.clear()
+	return nil
+}
+
+// send sends the packet `pkt` when it is due.
+func (s *SendScheduler) send(pkt Packet) {
+	if err := s.sender.Send(pkt); err != nil && s.opts.onError != nil {
+		s.opts.onError(err)
+	}
+}
@@ -0,0 +1,125 @@
+package osc
+
+import (
+	"testing"
+	"time"
+)
+
+// sentMessage is a message sent through a timedSender.
+type sentMessage struct {
+	addr string
+	at   time.Duration // Since fakeClockStart.
+}
+
+// timedSender passes the addresses of the messages sent to it to a channel,
+// with the time of the clock when they were sent.
+type timedSender struct {
+	clock Clock
+	ch    chan sentMessage
+}
+
+func (s *timedSender) Send(pkt Packet) error {
+	s.ch <- sentMessage{pkt.(*Message).Address, s.clock.Now().Sub(fakeClockStart)}
+	return nil
+}
+
+func TestSendScheduler(t *testing.T) {
+	clock := NewFakeClock(fakeClockStart)
+	s := &timedSender{clock: clock, ch: make(chan sentMessage, 10)}
+	ss, err := NewSendScheduler(s, SendSchedulerClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	schedule := func(d time.Duration, addr string) *ScheduledSend {
+		h, err := ss.Schedule(NewTimetag(fakeClockStart.Add(d)), NewMessage(addr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	receive := func() sentMessage {
+		select {
+		case m := <-s.ch:
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatal("no message sent")
+			return sentMessage{}
+		}
+	}
+
+	schedule(3*time.Second, "/c")
+	schedule(time.Second, "/a")
+	schedule(2*time.Second, "/b")
+	cancelled := schedule(2*time.Second, "/cancelled")
+	if !cancelled.Cancel() {
+		t.Error("Cancel() = false for a held packet")
+	}
+	if cancelled.Cancel() {
+		t.Error("Cancel() = true for a cancelled packet")
+	}
+	if got, want := ss.Len(), 3; got != want {
+		t.Errorf("Len() = %d, want %d", got, want)
+	}
+
+	if _, err := ss.Schedule(Immediate, NewMessage("/now")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := receive(), (sentMessage{"/now", 0}); got != want {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+
+	clock.Advance(time.Second)
+	if got, want := receive(), (sentMessage{"/a", time.Second}); got != want {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+
+	// Delay the rest by two seconds.
+	ss.Shift(2 * time.Second)
+	for i := 0; i < 4; i++ {
+		clock.Advance(time.Second)
+		if i == 2 {
+			if got, want := receive(), (sentMessage{"/b", 4 * time.Second}); got != want {
+				t.Errorf("sent %v, want %v", got, want)
+			}
+		}
+	}
+	if got, want := receive(), (sentMessage{"/c", 5 * time.Second}); got != want {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+	if got, want := ss.Len(), 0; got != want {
+		t.Errorf("Len() = %d, want %d", got, want)
+	}
+}
+
+func TestSendSchedulerClose(t *testing.T) {
+	clock := NewFakeClock(fakeClockStart)
+	s := &timedSender{clock: clock, ch: make(chan sentMessage, 10)}
+	ss, err := NewSendScheduler(s, SendSchedulerClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := ss.Schedule(NewTimetag(fakeClockStart.Add(time.Second)), NewMessage("/dropped"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ss.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ss.Len(), 0; got != want {
+		t.Errorf("Len() = %d, want %d", got, want)
+	}
+	if h.Cancel() {
+		t.Error("Cancel() = true for a dropped packet")
+	}
+	if _, err := ss.Schedule(Immediate, NewMessage("/late")); err != ErrSendSchedulerClosed {
+		t.Errorf("Schedule() error = %v, want %v", err, ErrSendSchedulerClosed)
+	}
+	clock.Advance(time.Second)
+	select {
+	case m := <-s.ch:
+		t.Errorf("sent %v after Close", m)
+	default:
+	}
+}
@@ -0,0 +1,227 @@
+package osc
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// SerialConn adapts a serial line, or any other io.ReadWriteCloser, to a
+// net.PacketConn that carries one framed OSC packet per read or write. This
+// lets a Server serve packets received from the line with Serve, and a Client
+// created with NewClientConn send packets through it. Serial devices usually
+// frame OSC with SLIP, see FramingSLIP.
+//
+// Read deadlines are supported for any io.ReadWriteCloser. Write deadlines are
+// passed on to the underlying stream if it supports them and ignored
+// otherwise.
+type SerialConn struct {
+	rwc    io.ReadWriteCloser
+	framer Framer
+	addr   serialAddr
+
+	frames   chan frame // Closed once reading fails.
+	readErr  error      // Error that ended reading; valid once frames is closed.
+	done     chan struct{}
+	closeErr error
+	once     sync.Once
+	deadline pipeDeadline
+}
+
+// Verify that interfaces are implemented properly.
+var _ net.PacketConn = (*SerialConn)(nil)
+
+// frame is the result of reading a single frame.
+type frame struct {
+	data []byte
+	err  error
+}
+
+// NewSerialConn returns a SerialConn that reads and writes packets on `rwc`
+// using the framing `f`. The SerialConn takes ownership of `rwc` and closes it
+// on Close.
+func NewSerialConn(rwc io.ReadWriteCloser, f Framing) (*SerialConn, error) {
+	framer, err := NewFramer(rwc, f)
+	if err != nil {
+		return nil, err
+	}
+	name := "serial"
+	if f, ok := rwc.(*os.File); ok {
+		name = f.Name()
+	}
+	c := &SerialConn{
+		rwc:      rwc,
+		framer:   framer,
+		addr:     serialAddr(name),
+		frames:   make(chan frame),
+		done:     make(chan struct{}),
+		deadline: makeDeadline(),
+	}
+	go c.readFrames()
+	return c, nil
+}
+
+// readFrames reads frames from the stream until it fails or the connection is
+// closed. Malformed SLIP frames are reported but do not end the stream.
+func (c *SerialConn) readFrames() {
+	for {
+		data, err := c.framer.ReadFrame()
+		if err != nil && err != errMalformedSLIP {
+			c.readErr = err
+			close(c.frames)
+			return
+		}
+		select {
+		case c.frames <- frame{data, err}:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// ReadFrom implements the net.PacketConn interface. It reads a single packet
+// into `p` and returns the address of the line. A malformed frame, or one
+// that does not fit in `p`, is returned as a *DecodeError, after which reading
+// can go on, so that Server.Serve drops it and keeps serving.
+func (c *SerialConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case <-c.done:
+		return 0, nil, c.opError("read", net.ErrClosed)
+	case <-c.deadline.wait():
+		return 0, nil, c.opError("read", os.ErrDeadlineExceeded)
+	case f, ok := <-c.frames:
+		if !ok {
+			return 0, nil, c.opError("read", c.readErr)
+		}
+		if f.err != nil {
+			return 0, c.addr, &DecodeError{Source: c.addr, Data: f.data, Err: f.err}
+		}
+		n := copy(p, f.data)
+		if n < len(f.data) {
+			return n, c.addr, &DecodeError{Source: c.addr, Data: f.data, Err: io.ErrShortBuffer}
+		}
+		return n, c.addr, nil
+	}
+}
+
+// WriteTo implements the net.PacketConn interface. The address is ignored, as
+// a serial line has a single peer.
+func (c *SerialConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.done:
+		return 0, c.opError("write", net.ErrClosed)
+	default:
+	}
+	if err := c.framer.WriteFrame(p); err != nil {
+		return 0, c.opError("write", err)
+	}
+	return len(p), nil
+}
+
+// Close closes the connection and the underlying stream.
+func (c *SerialConn) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+		c.closeErr = c.rwc.Close()
+	})
+	return c.closeErr
+}
+
+// LocalAddr implements the net.PacketConn interface.
+func (c *SerialConn) LocalAddr() net.Addr { return c.addr }
+
+// RemoteAddr returns the address of the line.
+func (c *SerialConn) RemoteAddr() net.Addr { return c.addr }
+
+// SetDeadline implements the net.PacketConn interface.
+func (c *SerialConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline implements the net.PacketConn interface.
+func (c *SerialConn) SetReadDeadline(t time.Time) error {
+	c.deadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline implements the net.PacketConn interface.
+func (c *SerialConn) SetWriteDeadline(t time.Time) error {
+	if d, ok := c.rwc.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		return d.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+func (c *SerialConn) opError(op string, err error) error {
+	if err == io.EOF {
+		return err
+	}
+	return &net.OpError{Op: op, Net: c.addr.Network(), Addr: c.addr, Err: err}
+}
+
+// serialAddr is the net.Addr of a serial line.
+type serialAddr string
+
+func (a serialAddr) Network() string { return "serial" }
+func (a serialAddr) String() string  { return string(a) }
+
+// pipeDeadline is a read deadline that can be waited on, modelled on the
+// deadline handling of net.Pipe.
+type pipeDeadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{} // Closed when the deadline passes.
+}
+
+func makeDeadline() pipeDeadline {
+	return pipeDeadline{cancel: make(chan struct{})}
+}
+
+// set sets the deadline to `t`. A zero value disables the deadline.
+func (d *pipeDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // Wait for the timer callback to close cancel.
+	}
+	d.timer = nil
+
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel that is closed when the deadline passes.
+func (d *pipeDeadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
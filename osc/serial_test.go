@@ -0,0 +1,208 @@
+package osc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSerialConnServer(t *testing.T) {
+	device, host := net.Pipe()
+	deviceConn, err := NewSerialConn(device, FramingSLIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer deviceConn.Close()
+	hostConn, err := NewSerialConn(host, FramingSLIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hostConn.Close()
+
+	server, err := NewServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.Handle("/led", func(msg *Message) {
+		msg.Reply(NewMessage("/led/ack", msg.Arguments...))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(context.Background(), hostConn)
+
+	client := NewClientConn(deviceConn, deviceConn.RemoteAddr())
+	if err := client.Send(NewMessage("/led", int32(13), true)); err != nil {
+		t.Fatalf("Send() unexpected error; %s", err)
+	}
+
+	deviceConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data := make([]byte, 1024)
+	n, addr, err := deviceConn.ReadFrom(data)
+	if err != nil {
+		t.Fatalf("ReadFrom() unexpected error; %s", err)
+	}
+	if got, want := addr.Network(), "serial"; got != want {
+		t.Errorf("ReadFrom() addr network = %s, want = %s", got, want)
+	}
+	pkt, err := decodePacket(data[:n])
+	if err != nil {
+		t.Fatalf("decodePacket() unexpected error; %s", err)
+	}
+	if got, want := pkt.String(), "/led/ack ,iT 13 true"; got != want {
+		t.Errorf("reply = %s, want = %s", got, want)
+	}
+}
+
+func TestSerialConnServerMalformedFrame(t *testing.T) {
+	for _, tt := range []struct {
+		desc  string
+		frame []byte // Sent before a valid frame.
+		err   error
+	}{
+		{"malformed", []byte{slipEnd, slipEsc, 0x42, slipEnd}, errMalformedSLIP},
+		{"oversized", append(append([]byte{slipEnd}, bytes.Repeat([]byte{1}, 70000)...), slipEnd), io.ErrShortBuffer},
+	} {
+		device, host := net.Pipe()
+		defer device.Close()
+		hostConn, err := NewSerialConn(host, FramingSLIP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer hostConn.Close()
+
+		decodeErrors := make(chan *DecodeError, 1)
+		server, err := NewServer("", ServerOnDecodeError(func(err *DecodeError) { decodeErrors <- err }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		received := make(chan *Message, 1)
+		if err := server.Handle("/led", func(msg *Message) { received <- msg }); err != nil {
+			t.Fatal(err)
+		}
+		served := make(chan error, 1)
+		go func() { served <- server.Serve(context.Background(), hostConn) }()
+
+		data, err := NewMessage("/led", int32(13)).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		frame := append([]byte(nil), tt.frame...)
+		frame = append(frame, data...) // The message needs no escaping.
+		frame = append(frame, slipEnd)
+		go device.Write(frame)
+
+		select {
+		case err := <-decodeErrors:
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s: DecodeError = %v, want %v", tt.desc, err, tt.err)
+			}
+		case err := <-served:
+			t.Fatalf("%s: Serve() returned after the frame; %v", tt.desc, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no decode error for the frame", tt.desc)
+		}
+		select {
+		case <-received:
+		case err := <-served:
+			t.Fatalf("%s: Serve() returned after the frame; %v", tt.desc, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: message after the frame not dispatched", tt.desc)
+		}
+	}
+}
+
+func TestSerialConnReadDeadline(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	c, err := NewSerialConn(a, FramingSLIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	_, _, err = c.ReadFrom(make([]byte, 16))
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("ReadFrom() error = %v, want a timeout", err)
+	}
+
+	// Clearing the deadline allows reads to proceed.
+	c.SetReadDeadline(time.Time{})
+	go b.Write([]byte{slipEnd, 1, 2, 3, 4, slipEnd})
+	buf := make([]byte, 16)
+	n, _, err := c.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom() unexpected error; %s", err)
+	}
+	if got, want := n, 4; got != want {
+		t.Errorf("ReadFrom() n = %d, want = %d", got, want)
+	}
+}
+
+func TestSerialConnMalformedFrame(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	c, err := NewSerialConn(a, FramingSLIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	go b.Write([]byte{slipEnd, slipEsc, 0x42, slipEnd, 7, 7, 7, 7, slipEnd})
+	buf := make([]byte, 16)
+	var derr *DecodeError
+	if _, _, err := c.ReadFrom(buf); !errors.As(err, &derr) || !errors.Is(err, errMalformedSLIP) {
+		t.Errorf("ReadFrom() error = %v, want a *DecodeError of %v", err, errMalformedSLIP)
+	}
+	n, _, err := c.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom() unexpected error after malformed frame; %s", err)
+	}
+	if got, want := n, 4; got != want {
+		t.Errorf("ReadFrom() n = %d, want = %d", got, want)
+	}
+
+	// Closing the peer ends the stream for good.
+	b.Close()
+	for i := 0; i < 2; i++ {
+		if _, _, err := c.ReadFrom(buf); err == nil {
+			t.Errorf("ReadFrom() #%d expected error after peer closed", i)
+		}
+	}
+}
+
+func TestSerialConnClientOversizedFrame(t *testing.T) {
+	device, host := net.Pipe()
+	defer device.Close()
+	hostConn, err := NewSerialConn(host, FramingSLIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hostConn.Close()
+	client := NewClientConn(hostConn, hostConn.RemoteAddr())
+	received := make(chan *Message, 1)
+	if err := client.Handle("/led", func(msg *Message) { received <- msg }); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := NewMessage("/led", int32(13)).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := append([]byte{slipEnd}, bytes.Repeat([]byte{1}, 70000)...)
+	frame = append(frame, slipEnd)
+	frame = append(frame, data...) // The message needs no escaping.
+	frame = append(frame, slipEnd)
+	go device.Write(frame)
+
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message after oversized frame not dispatched")
+	}
+}
@@ -2,13 +2,16 @@ package osc
 
 // Server represents an OSC server. The server listens on Address and Port for
 import (
-	"bufio"
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
 	"net"
+	"net/netip"
+	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -34,23 +37,77 @@ type Server struct {
 	dispatcher *OSCDispatcher
 
 	Addr string
+
+	closers  closerSet         // Connections being served.
+	reliable *reliableReceiver // Nil unless ServerReliable is set.
+	filter   *sourceFilter     // Nil unless sources are filtered or limited.
+	defaults sync.Once         // Sets the options of a Server not made by NewServer.
 }
 
 func NewServer(addr string, opts ...func(*serverOptions) error) (*Server, error) {
-	o := &serverOptions{}
-	o.setReadTimeout(1 * time.Second)
+	o := defaultServerOptions("udp")
 	for _, opt := range opts {
 		if err := opt(o); err != nil {
 			return nil, err
 		}
 	}
 	s := &Server{opts: o, Addr: addr}
-	s.dispatcher = NewOSCDispatcher()
+	s.dispatcher = o.newDispatcher()
+	if o.reliable {
+		s.reliable = newReliableReceiver(o.clock, o.logger)
+	}
+	s.filter = newSourceFilter(o)
 	return s, nil
 }
 
+// setDefaults gives a Server that was not made by NewServer, such as the zero
+// Server, the options NewServer would have given it.
+func (s *Server) setDefaults() {
+	s.defaults.Do(func() {
+		if s.opts == nil {
+			s.opts = defaultServerOptions("udp")
+			s.dispatcher = s.opts.newDispatcher()
+		}
+	})
+}
+
+func defaultServerOptions(network string) *serverOptions {
+	o := &serverOptions{network: network, clock: SystemClock, logger: discardLogger, metrics: nopMetrics{}, tracer: nopTracer{}}
+	o.setReadTimeout(1 * time.Second)
+	return o
+}
+
+// newDispatcher returns an OSCDispatcher with the clock, logger, metrics and
+// tracer of the options.
+func (o *serverOptions) newDispatcher() *OSCDispatcher {
+	d := NewOSCDispatcher()
+	d.SetClock(o.clock)
+	d.SetLogger(o.logger)
+	d.SetMetrics(o.metrics)
+	d.SetTracer(o.tracer)
+	return d
+}
+
+// discardLogger is the default logger, which logs nothing.
+var discardLogger = slog.New(slog.DiscardHandler)
+
 type serverOptions struct {
 	readTimeout time.Duration
+	network     string
+	framing     Framing
+	reliable    bool
+	timeSync    bool
+	clock       Clock
+	logger      *slog.Logger
+
+	onDecodeError func(err *DecodeError)
+	metrics       Metrics
+	tracer        Tracer
+
+	allow, deny []netip.Prefix
+	sourceRate  float64
+	sourceBurst int
+	onThrottled func(source net.Addr)
 }
 
 func ServerReadTimeout(v time.Duration) func(*serverOptions) error {
@@ -62,82 +119,347 @@ func (o *serverOptions) setReadTimeout(v time.Duration) error {
 	return nil
 }
 
+// ServerNetwork sets the network that ListenAndServe listens on. Server
+// supports "udp", "udp4", "udp6" and "unixgram"; StreamServer supports "tcp",
+// "tcp4", "tcp6" and "unix". For unix networks the address is the path of the
+// socket file.
+func ServerNetwork(v string) func(*serverOptions) error {
+	return func(o *serverOptions) error { return o.setNetwork(v) }
+}
+
+func (o *serverOptions) setNetwork(v string) error {
+	if checkPacketNetwork(v) != nil && checkStreamNetwork(v) != nil {
+		return fmt.Errorf("unsupported network: %q", v)
+	}
+	o.network = v
+	return nil
+}
+
+// ServerFraming sets the framing used by stream servers. The default is
+// FramingLengthPrefix.
+func ServerFraming(v Framing) func(*serverOptions) error {
+	return func(o *serverOptions) error { return o.setFraming(v) }
+}
+
+func (o *serverOptions) setFraming(v Framing) error {
+	if err := v.validate(); err != nil {
+		return err
+	}
+	o.framing = v
+	return nil
+}
+
+// ServerReliable enables the reliable delivery protocol of ReliableClient on
+// a datagram server: packets sent reliably are acknowledged and dispatched
+// once, even if they arrive several times. Plain packets are dispatched as
+// usual. Stream servers ignore this option.
+func ServerReliable(v bool) func(*serverOptions) error {
+	return func(o *serverOptions) error { return o.setReliable(v) }
+}
+
+func (o *serverOptions) setReliable(v bool) error {
+	o.reliable = v
+	return nil
+}
+
+// ServerTimeSync enables answering the time sync requests of TimeSync, with
+// time stamps taken from the clock of the server.
+func ServerTimeSync(v bool) func(*serverOptions) error {
+	return func(o *serverOptions) error { return o.setTimeSync(v) }
+}
+
+func (o *serverOptions) setTimeSync(v bool) error {
+	o.timeSync = v
+	return nil
+}
+
+// ServerLogger sets the logger for decode failures, dropped packets, late
+// bundles and handler panics. By default, nothing is logged.
+func ServerLogger(v *slog.Logger) func(*serverOptions) error {
+	return func(o *serverOptions) error { return o.setLogger(v) }
+}
+
+func (o *serverOptions) setLogger(v *slog.Logger) error {
+	if v == nil {
+		return errors.New("nil logger")
+	}
+	o.logger = v
+	return nil
+}
+
+// ServerOnDecodeError sets a function that is called with every received
+// packet that cannot be decoded. Such packets are dropped, and the server keeps
+// serving.
+func ServerOnDecodeError(v func(err *DecodeError)) func(*serverOptions) error {
+	return func(o *serverOptions) error { return o.setOnDecodeError(v) }
+}
+
+func (o *serverOptions) setOnDecodeError(v func(err *DecodeError)) error {
+	o.onDecodeError = v
+	return nil
+}
+
+// ServerMetrics sets the Metrics that receive the measurements of the server
+// and its dispatcher, for example a PrometheusMetrics.
+func ServerMetrics(v Metrics) func(*serverOptions) error {
+	return func(o *serverOptions) error { return o.setMetrics(v) }
+}
+
+func (o *serverOptions) setMetrics(v Metrics) error {
+	if v == nil {
+		return errors.New("nil metrics")
+	}
+	o.metrics = v
+	return nil
+}
+
+// ServerTracer sets the Tracer that records spans of the packets received by
+// the server and of their handlers. If it is a TracePropagator, the trace of
+// packets sent with WithTraceContext is continued.
+func ServerTracer(v Tracer) func(*serverOptions) error {
+	return func(o *serverOptions) error { return o.setTracer(v) }
+}
+
+func (o *serverOptions) setTracer(v Tracer) error {
+	if v == nil {
+		return errors.New("nil tracer")
+	}
+	o.tracer = v
+	return nil
+}
+
+// decodeFailed reports the packet of `err` that cannot be decoded.
+func (o *serverOptions) decodeFailed(err *DecodeError) {
+	o.metrics.PacketReceived(sourceHost(addrString(err.Source)), len(err.Data))
+	o.metrics.DecodeFailed(err.Kind())
+	o.logger.Warn("decoding packet failed", "source", addrString(err.Source), "error", err.Err)
+	if o.onDecodeError != nil {
+		o.onDecodeError(err)
+	}
+}
+
+// ServerAllow adds the CIDR prefix `v`, such as "192.168.1.0/24", or the
+// single IP address `v` to the sources that the server accepts packets from.
+// Once a source is allowed, packets from all other sources are dropped before
+// they are decoded, including those from sources without an IP address, such
+// as unix sockets. It may be given several times.
+func ServerAllow(v string) func(*serverOptions) error {
+	return func(o *serverOptions) error { return o.addAllow(v) }
+}
+
+func (o *serverOptions) addAllow(v string) error {
+	p, err := parsePrefix(v)
+	if err != nil {
+		return fmt.Errorf("invalid source %q: %w", v, err)
+	}
+	o.allow = append(o.allow, p)
+	return nil
+}
+
+// ServerDeny adds the CIDR prefix `v`, such as "10.0.0.0/8", or the single IP
+// address `v` to the sources whose packets are dropped before they are
+// decoded. Denying takes precedence over ServerAllow. It may be given several
+// times.
+func ServerDeny(v string) func(*serverOptions) error {
+	return func(o *serverOptions) error { return o.addDeny(v) }
+}
+
+func (o *serverOptions) addDeny(v string) error {
+	p, err := parsePrefix(v)
+	if err != nil {
+		return fmt.Errorf("invalid source %q: %w", v, err)
+	}
+	o.deny = append(o.deny, p)
+	return nil
+}
+
+// ServerSourceRate limits the packets accepted from each source IP address to
+// `rate` per second, with bursts of up to `burst` packets. Packets beyond the
+// limit are dropped before they are decoded, see ServerOnThrottled. There is
+// no limit by default.
+func ServerSourceRate(rate float64, burst int) func(*serverOptions) error {
+	return func(o *serverOptions) error { return o.setSourceRate(rate, burst) }
+}
+
+func (o *serverOptions) setSourceRate(rate float64, burst int) error {
+	if !(rate > 0) || math.IsInf(rate, 0) {
+		return fmt.Errorf("invalid source rate: %g", rate)
+	}
+	if burst < 1 {
+		return fmt.Errorf("invalid source burst: %d", burst)
+	}
+	o.sourceRate = rate
+	o.sourceBurst = burst
+	return nil
+}
+
+// ServerOnThrottled sets a function that is called when a source exceeds the
+// rate set with ServerSourceRate and its packets start being dropped. It is
+// called again once the source has been accepted in between. It is called by
+// the receiving goroutine, so it must not block.
+func ServerOnThrottled(v func(source net.Addr)) func(*serverOptions) error {
+	return func(o *serverOptions) error { return o.setOnThrottled(v) }
+}
+
+func (o *serverOptions) setOnThrottled(v func(source net.Addr)) error {
+	o.onThrottled = v
+	return nil
+}
+
+// ServerClock sets the clock that schedules bundles and keeps time for the
+// server, for example a FakeClock in tests. The default is SystemClock.
+func ServerClock(v Clock) func(*serverOptions) error {
+	return func(o *serverOptions) error { return o.setClock(v) }
+}
+
+func (o *serverOptions) setClock(v Clock) error {
+	if v == nil {
+		return errors.New("nil clock")
+	}
+	o.clock = v
+	return nil
+}
+
 // Handle registers a new message handler function for an OSC address. The
 // handler is the function called for incoming OscMessages that match 'address'.
 func (s *Server) Handle(addr string, handler HandlerFunc) error {
+	s.setDefaults()
 	return s.dispatcher.AddMsgHandler(addr, handler)
 }
 
 // ListenAndServe retrieves incoming OSC packets and dispatches the retrieved
-// OSC packets.
+// OSC packets. For unixgram servers, a stale socket file left at s.Addr is
+// removed before listening, and the socket file is removed again when serving
+// ends.
 func (s *Server) ListenAndServe() error {
-	ln, err := net.ListenPacket("udp", s.Addr)
+	s.setDefaults()
+	ln, err := listenPacket(s.opts.network, s.Addr)
 	if err != nil {
 		return err
 	}
+	defer ln.Close()
+	if isUnixSocketPath(s.opts.network, s.Addr) {
+		defer os.Remove(s.Addr)
+	}
 	return s.Serve(context.Background(), ln)
 }
 
 // Serve retrieves incoming OSC packets from the given connection and dispatches
-// retrieved OSC packets. If something goes wrong an error is returned.
+// retrieved OSC packets. If something goes wrong an error is returned. After
+// Close, Serve returns ErrServerClosed.
 func (s *Server) Serve(ctx context.Context, c net.PacketConn) error {
+	s.setDefaults()
+	if !s.closers.add(c) {
+		return ErrServerClosed
+	}
+	defer s.closers.remove(c)
+
 	var tempDelay time.Duration
 	for {
-		msg, err := s.ReceivePacket(ctx, c)
+		msg, size, err := s.receivePacket(ctx, c)
+		received := s.opts.clock.Now()
 		if err != nil {
+			var derr *DecodeError
+			if errors.As(err, &derr) {
+				s.opts.decodeFailed(derr)
+				continue // Only the packet is lost.
+			}
+			if s.closers.isClosed() {
+				return ErrServerClosed
+			}
 			// Attempt exponential back-off during temporary network problems.
 			if ne, ok := err.(net.Error); ok && ne.Temporary() {
-				if tempDelay == 0 {
-					tempDelay = 5 * time.Millisecond
-				} else {
-					tempDelay *= 2
-				}
-				if max := 1 * time.Second; tempDelay > max {
-					tempDelay = max
-				}
+				tempDelay = nextTempDelay(tempDelay)
 				time.Sleep(tempDelay)
 				continue // Try again.
 			}
 			return err // Error is not temporary.
 		}
 		tempDelay = 0
+		s.opts.metrics.PacketReceived(sourceHost(msg.Addr()), size)
+		if s.opts.timeSync && answerTimeSync(msg, received, s.opts.clock) {
+			continue
+		}
+		if s.reliable != nil {
+			var ok bool
+			if msg, ok = s.reliable.accept(msg); !ok {
+				continue
+			}
+		}
 		go s.dispatcher.Dispatch(msg)
 	}
+}
 
-	return nil
+// Close closes the connections being served, which makes Serve and
+// ListenAndServe return.
+func (s *Server) Close() error {
+	return s.closers.closeAll()
+}
+
+// nextTempDelay returns the back-off delay that follows `d` during temporary
+// network problems.
+func nextTempDelay(d time.Duration) time.Duration {
+	if d == 0 {
+		d = 5 * time.Millisecond
+	} else {
+		d *= 2
+	}
+	if max := 1 * time.Second; d > max {
+		d = max
+	}
+	return d
 }
 
 // ReceivePacket listens for incoming OSC packets and returns the packet and
-// client address if one is received.
+// client address if one is received. A packet that cannot be decoded is
+// returned as a *DecodeError, after which receiving can go on.
 func (s *Server) ReceivePacket(ctx context.Context, c net.PacketConn) (Packet, error) {
+	pkt, _, err := s.receivePacket(ctx, c)
+	return pkt, err
+}
+
+// receivePacket is like ReceivePacket, and also returns the size of the
+// packet.
+func (s *Server) receivePacket(ctx context.Context, c net.PacketConn) (Packet, int, error) {
+	s.setDefaults()
 	if deadline, ok := ctx.Deadline(); ok {
 		if err := c.SetReadDeadline(deadline); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 	}
 
-	go func() {
-		select {
-		// case <-time.After(200 * time.Millisecond):
-		// 	log.Println("Overslept.")
-		case <-ctx.Done():
-			log.Println(ctx.Err())
-		}
-	}()
-
 	data := make([]byte, 65535)
 	n, addr, err := c.ReadFrom(data)
+	for err == nil && s.filter != nil && !s.filter.admit(addr) {
+		n, addr, err = c.ReadFrom(data)
+	}
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	var start int
-	pkt, err := readPacket(bufio.NewReader(bytes.NewBuffer(data)), &start, n)
+	pkt, err := decodePacket(data[:n])
 	if err != nil {
-		return nil, err
+		return nil, 0, &DecodeError{Source: addr, Data: data[:n], Err: err}
 	}
-	pkt.SetAddr(addr)
-	return pkt, nil
+	setSource(pkt, addr, &packetReplier{conn: c, addr: addr})
+	pkt = traceReceived(s.opts.tracer, pkt, n)
+	return pkt, n, nil
+}
+
+// packetReplier sends packets back to the source of a datagram.
+type packetReplier struct {
+	conn net.PacketConn
+	addr net.Addr
+}
+
+// Send implements the Sender interface.
+func (r *packetReplier) Send(pkt Packet) error {
+	data, err := pkt.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = r.conn.WriteTo(data, r.addr)
+	return err
 }
 
 // Dispatcher is an interface for an OSC message dispatcher. A dispatcher is
@@ -148,9 +470,16 @@ type Dispatcher interface {
 }
 
 // OSCDispatcher is a dispatcher for OSC packets. It handles the dispatching of
-// received OSC packets.
+// received OSC packets. Bundles whose time tag is in the future are queued and
+// dispatched one at a time, in time tag order, when they are due.
 type OSCDispatcher struct {
+	mu       sync.RWMutex
 	handlers map[string]Handler
+	clock    Clock
+	logger   *slog.Logger
+	metrics  Metrics
+	tracer   Tracer
+	sched    *scheduler // Created on the first bundle scheduled for later.
 }
 
 // Verify that interfaces are implemented properly.
@@ -158,7 +487,46 @@ var _ Dispatcher = new(OSCDispatcher)
 
 // NewOSCDispatcher returns an OSCDispatcher.
 func NewOSCDispatcher() *OSCDispatcher {
-	return &OSCDispatcher{handlers: make(map[string]Handler)}
+	return &OSCDispatcher{
+		handlers: make(map[string]Handler),
+		clock:    SystemClock,
+		logger:   discardLogger,
+		metrics:  nopMetrics{},
+		tracer:   nopTracer{},
+	}
+}
+
+// SetClock sets the clock used to schedule bundles. It must be called before
+// the first packet is dispatched.
+func (d *OSCDispatcher) SetClock(c Clock) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clock = c
+}
+
+// SetLogger sets the logger for late bundles, messages without a handler and
+// handler panics. By default, nothing is logged.
+func (d *OSCDispatcher) SetLogger(l *slog.Logger) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.logger = l
+}
+
+// SetMetrics sets the Metrics that receive the counts of dispatched and
+// unmatched messages, the durations of handlers, the lateness of bundles and
+// the number of bundles waiting for their time tag.
+func (d *OSCDispatcher) SetMetrics(m Metrics) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.metrics = m
+}
+
+// SetTracer sets the Tracer that records spans of dispatching messages and of
+// calling their handlers.
+func (d *OSCDispatcher) SetTracer(t Tracer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tracer = t
 }
 
 // AddMsgHandler adds a new message handler for the given OSC address.
@@ -169,6 +537,8 @@ func (d *OSCDispatcher) AddMsgHandler(addr string, handler HandlerFunc) error {
 		}
 	}
 
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	if addressExists(addr, d.handlers) {
 		return fmt.Errorf("OSC address %q exists already", addr)
 	}
@@ -185,34 +555,134 @@ func (d *OSCDispatcher) Dispatch(pkt Packet) {
 
 	case *Message:
 		msg, _ := pkt.(*Message)
-		for addr, handler := range d.handlers {
-			if msg.Match(addr) {
-				handler.HandleMessage(msg)
-			}
-		}
+		d.dispatchMessage(msg)
 
 	case *Bundle:
 		bundle, _ := pkt.(*Bundle)
-		timer := time.NewTimer(bundle.Timetag.ExpiresIn())
-
-		go func() {
-			<-timer.C
-			for _, message := range bundle.Messages {
-				for address, handler := range d.handlers {
-					if message.Match(address) {
-						handler.HandleMessage(message)
-					}
-				}
-			}
+		d.scheduleBundle(bundle, true)
+	}
+}
 
-			// Process all bundles
-			for _, b := range bundle.Bundles {
-				d.Dispatch(b)
-			}
-		}()
+// scheduleBundle dispatches `bundle` when it is due. Bundles that have just
+// been `received` are logged if they are late.
+func (d *OSCDispatcher) scheduleBundle(bundle *Bundle, received bool) {
+	sched, at, late := d.schedulerFor(bundle.Timetag)
+	if sched != nil {
+		sched.schedule(at, func() {
+			clock, _, metrics := d.settings()
+			metrics.QueueDepth(sched.len())
+			metrics.BundleDue(max(clock.Now().Sub(at), 0))
+			d.dispatchBundle(bundle)
+		})
+		_, _, metrics := d.settings()
+		metrics.QueueDepth(sched.len())
+		return
+	}
+	if received && !bundle.Timetag.IsImmediate() {
+		_, logger, metrics := d.settings()
+		metrics.BundleDue(late)
+		if late > 0 {
+			logger.Warn("late bundle", "source", bundle.Addr(), "timetag", bundle.Timetag.String(), "late", late)
+		}
+	}
+	d.dispatchBundle(bundle)
+}
+
+// schedulerFor returns the scheduler and the time to dispatch a bundle with
+// the time tag `tt`, or nil and how late the bundle is if it is due.
+func (d *OSCDispatcher) schedulerFor(tt Timetag) (sched *scheduler, at time.Time, late time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if tt.IsImmediate() {
+		return nil, time.Time{}, 0
+	}
+	at = tt.Time()
+	if late = d.clock.Now().Sub(at); late >= 0 {
+		return nil, at, late
+	}
+	if d.sched == nil {
+		d.sched = newScheduler(d.clock)
+	}
+	return d.sched, at, 0
+}
+
+// dispatchBundle dispatches the elements of `bundle`. Nested bundles are
+// scheduled by their own time tags.
+func (d *OSCDispatcher) dispatchBundle(bundle *Bundle) {
+	for _, message := range bundle.Messages {
+		d.dispatchMessage(message)
+	}
+
+	// Process all bundles
+	for _, b := range bundle.Bundles {
+		d.scheduleBundle(b, false)
 	}
 }
 
+// dispatchMessage calls the handlers whose address matches `msg`.
+func (d *OSCDispatcher) dispatchMessage(msg *Message) {
+	d.mu.RLock()
+	var addrs []string
+	for addr := range d.handlers {
+		if msg.Match(addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	handlers := make([]Handler, len(addrs))
+	for i, addr := range addrs {
+		handlers[i] = d.handlers[addr]
+	}
+	clock, logger, metrics, tracer := d.clock, d.logger, d.metrics, d.tracer
+	d.mu.RUnlock()
+
+	ctx, span := tracer.Start(msg.Context(), "osc.dispatch", slog.String("address", msg.Address), slog.Int("handlers", len(handlers)))
+	defer span.End(nil)
+	_, untraced := tracer.(nopTracer)
+
+	if len(handlers) == 0 {
+		metrics.MessageUnmatched(msg.Address)
+		logger.Debug("dropped message without handler", "source", msg.Addr(), "address", msg.Address)
+		return
+	}
+	for i, handler := range handlers {
+		metrics.MessageDispatched(addrs[i])
+		hctx, hspan := tracer.Start(ctx, "osc.handle", slog.String("handler", addrs[i]))
+		hmsg := msg
+		if !untraced {
+			// Handlers see their own span in msg.Context(). The message may
+			// be shared with watchers and other goroutines, so each handler
+			// gets a copy instead of changing it.
+			c := *msg
+			c.ctx = hctx
+			hmsg = &c
+		}
+		start := clock.Now()
+		err := callHandler(handler, hmsg, logger)
+		metrics.HandlerDone(addrs[i], clock.Now().Sub(start))
+		hspan.End(err)
+	}
+}
+
+// callHandler calls `handler` with `msg`. A panic of the handler is logged,
+// returned as an error and does not stop the dispatching of further messages.
+func callHandler(handler Handler, msg *Message, logger *slog.Logger) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("handler panicked", "source", msg.Addr(), "address", msg.Address, "panic", r)
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	handler.HandleMessage(msg)
+	return nil
+}
+
+// settings returns the clock, logger and metrics of the dispatcher.
+func (d *OSCDispatcher) settings() (Clock, *slog.Logger, Metrics) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.clock, d.logger, d.metrics
+}
+
 // existsAddress returns true if the OSC address `addr` is found in `handlers`.
 func addressExists(addr string, handlers map[string]Handler) bool {
 	for h := range handlers {
@@ -2,6 +2,7 @@ package osc
 
 import (
 	"context"
+	"log/slog"
 	"net"
 	"sync"
 	"testing"
@@ -38,13 +39,15 @@ func TestMessageDispatching(t *testing.T) {
 	go func() {
 		conn, err := net.ListenPacket("udp", "localhost:6677")
 		if err != nil {
-			t.Fatal(err)
+			t.Error(err)
+			return
 		}
 		defer conn.Close()
 
 		server, err := NewServer("localhost:6677")
 		if err != nil {
-			t.Fatal(err)
+			t.Error(err)
+			return
 		}
 		err = server.Handle("/address/test", func(msg *Message) {
 			if len(msg.Arguments) != 1 {
@@ -102,7 +105,8 @@ func TestMessageReceiving(t *testing.T) {
 		server := mockServer()
 		c, err := net.ListenPacket("udp", "localhost:6677")
 		if err != nil {
-			t.Fatal(err)
+			t.Error(err)
+			return
 		}
 		defer c.Close()
 
@@ -167,19 +171,22 @@ func TestReadTimeout(t *testing.T) {
 
 		select {
 		case <-time.After(5 * time.Second):
-			t.Fatal("timed out")
+			t.Error("timed out")
+			return
 		case <-start:
 			client := NewClient("localhost", 6677)
 			msg := NewMessage("/address/test1")
 			err := client.Send(msg)
 			if err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 			time.Sleep(150 * time.Millisecond)
 			msg = NewMessage("/address/test2")
 			err = client.Send(msg)
 			if err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 		}
 	}()
@@ -192,12 +199,14 @@ func TestReadTimeout(t *testing.T) {
 		server := mockServer()
 		c, err := net.ListenPacket("udp", "localhost:6677")
 		if err != nil {
-			t.Fatal(err)
+			t.Error(err)
+			return
 		}
 		defer c.Close()
 
 		start <- true
-		ctx, _ := context.WithTimeout(context.Background(), timeout)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
 		p, err := server.ReceivePacket(ctx, c)
 		if err != nil {
 			t.Errorf("server error: %v", err)
@@ -209,14 +218,16 @@ func TestReadTimeout(t *testing.T) {
 		}
 
 		// Second receive should time out since client is delayed 150 milliseconds
-		ctx, _ = context.WithTimeout(context.Background(), timeout)
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		defer cancel()
 		if _, err = server.ReceivePacket(ctx, c); err == nil {
 			t.Errorf("expected error")
 			return
 		}
 
 		// Next receive should get it
-		ctx, _ = context.WithTimeout(context.Background(), timeout)
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		defer cancel()
 		p, err = server.ReceivePacket(ctx, c)
 		if err != nil {
 			t.Errorf("server error: %v", err)
@@ -234,3 +245,225 @@ func TestReadTimeout(t *testing.T) {
 func mockServer() *Server {
 	return &Server{Addr: "localhost"}
 }
+
+func TestDispatcherSchedulesBundles(t *testing.T) {
+	clock := NewFakeClock(fakeClockStart)
+	d := NewOSCDispatcher()
+	d.SetClock(clock)
+	received := make(chan string, 10)
+	for _, addr := range []string{"/now", "/past", "/one", "/two", "/nested"} {
+		if err := d.AddMsgHandler(addr, func(msg *Message) { received <- msg.Address }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundleAt := func(at time.Time, addr string) *Bundle {
+		b := NewBundle(at)
+		b.Append(NewMessage(addr))
+		return b
+	}
+
+	two := bundleAt(fakeClockStart.Add(2*time.Second), "/two")
+	two.Append(bundleAt(fakeClockStart.Add(3*time.Second), "/nested"))
+	d.Dispatch(two)
+	d.Dispatch(bundleAt(fakeClockStart.Add(time.Second), "/one"))
+	d.Dispatch(bundleAt(time.Time{}, "/now"))
+	d.Dispatch(bundleAt(fakeClockStart.Add(-time.Second), "/past"))
+
+	// Bundles that are due are dispatched right away.
+	for _, want := range []string{"/now", "/past"} {
+		if got := <-received; got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+
+	for _, want := range []string{"/one", "/two", "/nested"} {
+		clock.BlockUntil(1)
+		select {
+		case got := <-received:
+			t.Fatalf("got %s before it was due", got)
+		default:
+		}
+		clock.Advance(time.Second)
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not dispatched", want)
+		}
+	}
+}
+
+// recordingHandler is a slog.Handler that records the messages logged and
+// their attributes.
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *recordingHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r.Clone())
+	return nil
+}
+
+// wait waits for a record with the message `msg` and returns its attributes.
+func (h *recordingHandler) wait(t *testing.T, msg string) map[string]string {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		h.mu.Lock()
+		for _, r := range h.records {
+			if r.Message == msg {
+				attrs := make(map[string]string)
+				r.Attrs(func(a slog.Attr) bool {
+					attrs[a.Key] = a.Value.String()
+					return true
+				})
+				h.mu.Unlock()
+				return attrs
+			}
+		}
+		h.mu.Unlock()
+	}
+	t.Fatalf("%q not logged", msg)
+	return nil
+}
+
+func TestServerLogging(t *testing.T) {
+	h := &recordingHandler{}
+	server, err := NewServer("", ServerLogger(slog.New(h)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Handle("/panic", func(msg *Message) { panic("boom") }); err != nil {
+		t.Fatal(err)
+	}
+	addr := startServer(t, server)
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	src := conn.LocalAddr().String()
+
+	bundle := NewBundle(time.Now().Add(-time.Second))
+	bundle.Append(NewMessage("/panic"))
+	bundle.Append(NewMessage("/unhandled"))
+	data, err := bundle.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		msg   string
+		attrs map[string]string
+	}{
+		{"late bundle", map[string]string{"source": src}},
+		{"handler panicked", map[string]string{"source": src, "address": "/panic", "panic": "boom"}},
+		{"dropped message without handler", map[string]string{"source": src, "address": "/unhandled"}},
+	} {
+		got := h.wait(t, tt.msg)
+		for k, want := range tt.attrs {
+			if got[k] != want {
+				t.Errorf("%s: %s = %q, want %q", tt.msg, k, got[k], want)
+			}
+		}
+	}
+
+	if _, err := conn.Write([]byte("/abc")); err != nil {
+		t.Fatal(err)
+	}
+	got := h.wait(t, "decoding packet failed")
+	if got["source"] != src || got["error"] == "" {
+		t.Errorf("decoding packet failed: got %v, want source %s and an error", got, src)
+	}
+}
+
+func TestServerSurvivesGarbage(t *testing.T) {
+	decodeErrors := make(chan *DecodeError, 10)
+	server, err := NewServer("", ServerOnDecodeError(func(err *DecodeError) { decodeErrors <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan *Message, 1)
+	if err := server.Handle("/ok", func(msg *Message) { received <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("udp", startServer(t, server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	garbage := [][]byte{
+		[]byte("x"),
+		[]byte("/abc"),
+		[]byte("#bundle\x00"),
+		[]byte("/a\x00\x00,b\x00\x00\x7f\xff\xff\xff"),
+		{0, 0, 0, 0},
+	}
+	for _, data := range garbage {
+		if _, err := conn.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range garbage {
+		select {
+		case err := <-decodeErrors:
+			if got := err.Data; string(got) != string(want) {
+				t.Errorf("DecodeError.Data = %q, want %q", got, want)
+			}
+			if got, want := err.Source.String(), conn.LocalAddr().String(); got != want {
+				t.Errorf("DecodeError.Source = %s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no decode error for %q", want)
+		}
+	}
+
+	// The server is still serving.
+	data, err := NewMessage("/ok").MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message after garbage not dispatched")
+	}
+}
+
+func TestZeroServer(t *testing.T) {
+	var server Server
+	received := make(chan string, 1)
+	if err := server.Handle("/fader", func(msg *Message) { received <- msg.Address }); err != nil {
+		t.Fatal(err)
+	}
+	client, err := Dial("udp", startServer(t, &server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Send(NewMessage("/fader", float32(0.5))); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if want := "/fader"; got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not dispatched")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package osc
+
+import "errors"
+
+// set sets the options on the socket `fd`.
+func (mo *multicastOptions) set(fd uintptr) error {
+	return errors.New("multicast options are not supported on this platform")
+}
+
+// setBroadcast allows sending broadcast packets on the socket `fd`.
+func setBroadcast(fd uintptr) error {
+	return errors.New("broadcast is not supported on this platform")
+}
@@ -0,0 +1,56 @@
+//go:build unix
+
+package osc
+
+import "syscall"
+
+// set sets the options on the socket `fd`.
+func (mo *multicastOptions) set(fd uintptr) error {
+	s := int(fd)
+	if mo.ipv6 {
+		if mo.ttl != 0 {
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_HOPS, mo.ttl); err != nil {
+				return err
+			}
+		}
+		if mo.noLoopback {
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_LOOP, 0); err != nil {
+				return err
+			}
+		}
+		if mo.ifIndex != 0 {
+			return syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_IF, mo.ifIndex)
+		}
+		return nil
+	}
+
+	if mo.ttl != 0 {
+		if err := setsockoptByteOrInt(s, syscall.IPPROTO_IP, syscall.IP_MULTICAST_TTL, mo.ttl); err != nil {
+			return err
+		}
+	}
+	if mo.noLoopback {
+		if err := setsockoptByteOrInt(s, syscall.IPPROTO_IP, syscall.IP_MULTICAST_LOOP, 0); err != nil {
+			return err
+		}
+	}
+	if mo.ifIndex != 0 {
+		return syscall.SetsockoptInet4Addr(s, syscall.IPPROTO_IP, syscall.IP_MULTICAST_IF, mo.ifAddr)
+	}
+	return nil
+}
+
+// setsockoptByteOrInt sets an IPv4 multicast option, which some systems take
+// as an int and others, like OpenBSD, only as a byte.
+func setsockoptByteOrInt(fd, level, opt, v int) error {
+	err := syscall.SetsockoptInt(fd, level, opt, v)
+	if err == syscall.EINVAL {
+		return syscall.SetsockoptByte(fd, level, opt, byte(v))
+	}
+	return err
+}
+
+// setBroadcast allows sending broadcast packets on the socket `fd`.
+func setBroadcast(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1)
+}
@@ -0,0 +1,16 @@
+package osc
+
+import (
+	"errors"
+	"syscall"
+)
+
+// set sets the options on the socket `fd`.
+func (mo *multicastOptions) set(fd uintptr) error {
+	return errors.New("multicast options are not supported on this platform")
+}
+
+// setBroadcast allows sending broadcast packets on the socket `fd`.
+func setBroadcast(fd uintptr) error {
+	return syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1)
+}
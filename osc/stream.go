@@ -0,0 +1,313 @@
+package osc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+)
+
+// ErrServerClosed is returned by the Serve methods after a call to Close.
+var ErrServerClosed = errors.New("server closed")
+
+// StreamServer represents an OSC server for stream transports such as TCP.
+// Every connection carries framed OSC packets in both directions, so handlers
+// can reply to the sending peer with Message.Reply.
+type StreamServer struct {
+	opts       *serverOptions
+	dispatcher *OSCDispatcher
+	filter     *sourceFilter // Nil unless sources are filtered or limited.
+
+	Addr string
+
+	closers closerSet // Active listeners and connections.
+}
+
+// NewStreamServer returns a StreamServer that listens on the address `addr`
+// when ListenAndServe is called. The network is "tcp" unless set with
+// ServerNetwork; unix stream sockets are selected with "unix".
+func NewStreamServer(addr string, opts ...func(*serverOptions) error) (*StreamServer, error) {
+	o := defaultServerOptions("tcp")
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	s := &StreamServer{
+		opts:       o,
+		dispatcher: o.newDispatcher(),
+		filter:     newSourceFilter(o),
+		Addr:       addr,
+	}
+	return s, nil
+}
+
+// Handle registers a new message handler function for an OSC address.
+func (s *StreamServer) Handle(addr string, handler HandlerFunc) error {
+	return s.dispatcher.AddMsgHandler(addr, handler)
+}
+
+// ListenAndServe listens on the address s.Addr and serves incoming
+// connections. For unix servers, a stale socket file left at s.Addr is removed
+// before listening, and the socket file is removed again when serving ends.
+func (s *StreamServer) ListenAndServe() error {
+	ln, err := listenStream(s.opts.network, s.Addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	if isUnixSocketPath(s.opts.network, s.Addr) {
+		defer os.Remove(s.Addr)
+	}
+	return s.Serve(context.Background(), ln)
+}
+
+// Serve accepts connections on `ln` and serves each of them in a new
+// goroutine. Serve always closes `ln` before returning.
+func (s *StreamServer) Serve(ctx context.Context, ln net.Listener) error {
+	defer ln.Close()
+	if !s.closers.add(ln) {
+		return ErrServerClosed
+	}
+	defer s.closers.remove(ln)
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+
+	var tempDelay time.Duration
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if s.closers.isClosed() {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				tempDelay = nextTempDelay(tempDelay)
+				time.Sleep(tempDelay)
+				continue // Try again.
+			}
+			return err
+		}
+		tempDelay = 0
+		go func() {
+			defer conn.Close()
+			s.ServeConn(ctx, conn)
+		}()
+	}
+}
+
+// ServeConn reads OSC packets from a single stream and dispatches them until
+// the stream ends, an error occurs or `ctx` is done. Messages received on the
+// same stream are dispatched in order. Packets that cannot be decoded are
+// dropped, see ServerOnDecodeError. ServeConn does not close `rw`.
+func (s *StreamServer) ServeConn(ctx context.Context, rw io.ReadWriter) error {
+	if c, ok := rw.(io.Closer); ok {
+		if !s.closers.add(c) {
+			return ErrServerClosed
+		}
+		defer s.closers.remove(c)
+	}
+	stop := interruptOnDone(ctx, rw)
+	defer stop()
+
+	f, err := NewFramer(rw, s.opts.framing)
+	if err != nil {
+		return err
+	}
+	reply := &streamReplier{framer: f}
+	addr := remoteAddr(rw)
+	if s.filter != nil && !s.filter.allows(addr) {
+		return nil
+	}
+	for {
+		data, err := f.ReadFrame()
+		received := s.opts.clock.Now()
+		if err == errMalformedSLIP {
+			// The frame ends at the next END byte, so only the packet is lost.
+			s.opts.decodeFailed(&DecodeError{Source: addr, Data: data, Err: err})
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == io.EOF || errors.Is(err, net.ErrClosed) || s.closers.isClosed() {
+				return nil
+			}
+			return err
+		}
+		if s.filter != nil && !s.filter.take(addr) {
+			continue
+		}
+		pkt, err := decodePacket(data)
+		if err != nil {
+			// The framing is intact, so only the packet is lost.
+			s.opts.decodeFailed(&DecodeError{Source: addr, Data: data, Err: err})
+			continue
+		}
+		s.opts.metrics.PacketReceived(sourceHost(addrString(addr)), len(data))
+		setSource(pkt, addr, reply)
+		pkt = traceReceived(s.opts.tracer, pkt, len(data))
+		if s.opts.timeSync && answerTimeSync(pkt, received, s.opts.clock) {
+			continue
+		}
+		s.dispatcher.Dispatch(pkt)
+	}
+}
+
+// Close closes all listeners and connections served by the server.
+func (s *StreamServer) Close() error {
+	return s.closers.closeAll()
+}
+
+// streamReplier sends packets back over the stream a packet was received on.
+type streamReplier struct {
+	framer Framer
+}
+
+// Send implements the Sender interface.
+func (r *streamReplier) Send(pkt Packet) error {
+	data, err := pkt.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return r.framer.WriteFrame(data)
+}
+
+// StreamClient sends OSC packets over a stream transport such as TCP. Packets
+// sent back by the peer are dispatched to the handlers registered with Handle
+// while Serve is running.
+type StreamClient struct {
+	rwc        io.ReadWriteCloser
+	framer     Framer
+	dispatcher *OSCDispatcher
+	logger     *slog.Logger
+}
+
+// Verify that interfaces are implemented properly.
+var _ Sender = (*StreamClient)(nil)
+
+// DialStream connects to the address `addr` on the named stream network,
+// "tcp" or "unix", and returns a StreamClient for the connection.
+func DialStream(network, addr string, opts ...func(*clientOptions) error) (*StreamClient, error) {
+	if err := checkStreamNetwork(network); err != nil {
+		return nil, err
+	}
+	o, err := newClientOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamClient(conn, o)
+}
+
+// NewStreamClient returns a StreamClient that sends and receives packets over
+// `rwc`. The client takes ownership of `rwc` and closes it on Close.
+func NewStreamClient(rwc io.ReadWriteCloser, opts ...func(*clientOptions) error) (*StreamClient, error) {
+	o, err := newClientOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamClient(rwc, o)
+}
+
+func newStreamClient(rwc io.ReadWriteCloser, o *clientOptions) (*StreamClient, error) {
+	f, err := NewFramer(rwc, o.framing)
+	if err != nil {
+		rwc.Close()
+		return nil, err
+	}
+	c := &StreamClient{
+		rwc:        rwc,
+		framer:     f,
+		dispatcher: NewOSCDispatcher(),
+		logger:     o.logger,
+	}
+	c.dispatcher.SetClock(o.clock)
+	c.dispatcher.SetLogger(c.logger)
+	return c, nil
+}
+
+// Handle registers a message handler function for packets received from the
+// peer.
+func (c *StreamClient) Handle(addr string, handler HandlerFunc) error {
+	return c.dispatcher.AddMsgHandler(addr, handler)
+}
+
+// Send implements the Sender interface.
+func (c *StreamClient) Send(pkt Packet) error {
+	data, err := pkt.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return c.framer.WriteFrame(data)
+}
+
+func (c *StreamClient) sendData(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.framer.WriteFrame(data)
+}
+
+// Serve reads OSC packets sent by the peer and dispatches them until the
+// stream ends, an error occurs or `ctx` is done. It returns nil when the peer
+// closes the stream or the client is closed. Packets that cannot be decoded are
+// dropped.
+func (c *StreamClient) Serve(ctx context.Context) error {
+	stop := interruptOnDone(ctx, c.rwc)
+	defer stop()
+
+	addr := remoteAddr(c.rwc)
+	for {
+		data, err := c.framer.ReadFrame()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == io.EOF || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		pkt, err := decodePacket(data)
+		if err != nil {
+			c.logger.Warn("dropped undecodable packet", "source", addrString(addr), "error", err)
+			continue
+		}
+		setSource(pkt, addr, c)
+		c.dispatcher.Dispatch(pkt)
+	}
+}
+
+// Close closes the underlying stream.
+func (c *StreamClient) Close() error {
+	return c.rwc.Close()
+}
+
+// remoteAddr returns the address of the peer of `v`, if it has one.
+func remoteAddr(v interface{}) net.Addr {
+	if c, ok := v.(interface{ RemoteAddr() net.Addr }); ok {
+		return c.RemoteAddr()
+	}
+	return nil
+}
+
+// interruptOnDone unblocks pending reads on `v` once `ctx` is done, provided
+// `v` supports read deadlines. The returned function releases the watch.
+func interruptOnDone(ctx context.Context, v interface{}) (stop func()) {
+	d, ok := v.(interface{ SetReadDeadline(time.Time) error })
+	if !ok {
+		return func() {}
+	}
+	release := context.AfterFunc(ctx, func() { d.SetReadDeadline(time.Now()) })
+	return func() { release() }
+}
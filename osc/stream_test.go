@@ -0,0 +1,289 @@
+package osc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// startStreamServer serves `s` on an ephemeral loopback TCP port and returns
+// the listening address.
+func startStreamServer(t *testing.T, s *StreamServer) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(context.Background(), ln)
+	t.Cleanup(func() { s.Close() })
+	return ln.Addr().String()
+}
+
+func TestStreamServerReply(t *testing.T) {
+	server, err := NewStreamServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan *Message, 1)
+	err = server.Handle("/ping", func(msg *Message) {
+		received <- msg
+		if err := msg.Reply(NewMessage("/pong", msg.Arguments...)); err != nil {
+			t.Errorf("Reply() unexpected error; %s", err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := startStreamServer(t, server)
+
+	client, err := DialStream("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	replies := make(chan *Message, 1)
+	if err := client.Handle("/pong", func(msg *Message) { replies <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	go client.Serve(context.Background())
+
+	if err := client.Send(NewMessage("/ping", int32(42), "hello")); err != nil {
+		t.Fatalf("Send() unexpected error; %s", err)
+	}
+
+	select {
+	case msg := <-received:
+		if got, want := msg.Addr(), client.rwc.(net.Conn).LocalAddr().String(); got != want {
+			t.Errorf("Addr() = %s, want = %s", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+	select {
+	case msg := <-replies:
+		if got, want := msg.String(), "/pong ,is 42 hello"; got != want {
+			t.Errorf("reply = %s, want = %s", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reply")
+	}
+}
+
+func TestStreamServerBundle(t *testing.T) {
+	server, err := NewStreamServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 2)
+	for _, addr := range []string{"/a", "/b"} {
+		err := server.Handle(addr, func(msg *Message) { received <- msg.Address })
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	addr := startStreamServer(t, server)
+
+	client, err := DialStream("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	bundle := NewBundle(time.Now())
+	bundle.Append(NewMessage("/a"))
+	bundle.Append(NewMessage("/b"))
+	if err := client.Send(bundle); err != nil {
+		t.Fatalf("Send() unexpected error; %s", err)
+	}
+
+	got := map[string]bool{}
+	for len(got) < 2 {
+		select {
+		case a := <-received:
+			got[a] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for bundle messages; got %v", got)
+		}
+	}
+}
+
+func TestStreamServerClose(t *testing.T) {
+	server, err := NewStreamServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(context.Background(), ln) }()
+
+	client, err := DialStream("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	served := make(chan error, 1)
+	go func() { served <- client.Serve(context.Background()) }()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := server.Close(); err != nil {
+		t.Errorf("Close() unexpected error; %s", err)
+	}
+	select {
+	case err := <-done:
+		if err != ErrServerClosed {
+			t.Errorf("Serve() = %v, want = %v", err, ErrServerClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() did not return after Close()")
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("client Serve() = %v, want = nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("client connection was not closed")
+	}
+}
+
+func TestStreamSLIPPipe(t *testing.T) {
+	server, err := NewStreamServer("", ServerFraming(FramingSLIP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.Handle("/echo", func(msg *Message) {
+		msg.Reply(NewMessage("/echoed", msg.Arguments...))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	go server.ServeConn(context.Background(), remote)
+
+	client, err := NewStreamClient(local, ClientFraming(FramingSLIP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	replies := make(chan *Message, 1)
+	if err := client.Handle("/echoed", func(msg *Message) { replies <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	go client.Serve(context.Background())
+
+	// The argument is encoded as 0xc0dbdcdd, which contains the SLIP END and
+	// ESC bytes that must be escaped.
+	arg := int32(-0x3f242323)
+	if err := client.Send(NewMessage("/echo", arg, "\xc0\xdb")); err != nil {
+		t.Fatalf("Send() unexpected error; %s", err)
+	}
+	select {
+	case msg := <-replies:
+		if got, want := msg.Arguments, []interface{}{arg, "\xc0\xdb"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("reply arguments = %v, want = %v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reply")
+	}
+}
+
+func TestStreamClientInvalidFraming(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+	if _, err := NewStreamClient(local, ClientFraming(Framing(42))); err == nil {
+		t.Error("NewStreamClient() expected error for invalid framing")
+	}
+	if _, err := NewStreamServer("", ServerFraming(Framing(42))); err == nil {
+		t.Error("NewStreamServer() expected error for invalid framing")
+	}
+}
+
+func TestStreamServerSurvivesGarbage(t *testing.T) {
+	decodeErrors := make(chan *DecodeError, 1)
+	server, err := NewStreamServer("", ServerOnDecodeError(func(err *DecodeError) { decodeErrors <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan *Message, 1)
+	if err := server.Handle("/ok", func(msg *Message) { received <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	client, err := DialStream("tcp", startStreamServer(t, server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := client.sendData(context.Background(), []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Send(NewMessage("/ok")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-decodeErrors:
+		if got, want := string(err.Data), "garbage"; got != want {
+			t.Errorf("DecodeError.Data = %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no decode error")
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message after garbage not dispatched")
+	}
+}
+
+func TestStreamServerMalformedSLIPFrame(t *testing.T) {
+	decodeErrors := make(chan *DecodeError, 1)
+	server, err := NewStreamServer("",
+		ServerFraming(FramingSLIP),
+		ServerOnDecodeError(func(err *DecodeError) { decodeErrors <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan *Message, 1)
+	if err := server.Handle("/ok", func(msg *Message) { received <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	local, remote := net.Pipe()
+	defer local.Close()
+	served := make(chan error, 1)
+	go func() { served <- server.ServeConn(context.Background(), remote) }()
+
+	data, err := NewMessage("/ok").MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := []byte{slipEnd, slipEsc, 0x42, slipEnd}
+	frames = append(frames, data...) // The message needs no escaping.
+	frames = append(frames, slipEnd)
+	go local.Write(frames)
+
+	select {
+	case err := <-decodeErrors:
+		if !errors.Is(err, errMalformedSLIP) {
+			t.Errorf("DecodeError = %v, want %v", err, errMalformedSLIP)
+		}
+	case err := <-served:
+		t.Fatalf("ServeConn() returned after malformed SLIP frame; %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no decode error for the malformed frame")
+	}
+	select {
+	case <-received:
+	case err := <-served:
+		t.Fatalf("ServeConn() returned after malformed SLIP frame; %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message after malformed frame not dispatched")
+	}
+}
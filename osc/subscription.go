@@ -0,0 +1,163 @@
+package osc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Subscription keeps a subscription with a remote device alive. Many devices
+// only push updates to clients that renew their subscription regularly, for
+// example the Behringer X32 with /xremote. A Subscription resends a message or
+// bundle through a Client on an interval, and tracks whether the device is
+// still replying.
+type Subscription struct {
+	client   *Client
+	pkt      Packet
+	interval time.Duration
+	opts     *subscriptionOptions
+
+	notifyMu  sync.Mutex // Held while changing the liveness and reporting it.
+	mu        sync.Mutex
+	lastReply time.Time
+	alive     bool
+}
+
+type subscriptionOptions struct {
+	replyAddr  string
+	timeout    time.Duration
+	onLiveness func(alive bool)
+}
+
+// SubscriptionReplyAddr sets the OSC address pattern of the messages that
+// show the device is alive. By default, any message received by the client
+// counts as a reply.
+func SubscriptionReplyAddr(v string) func(*subscriptionOptions) error {
+	return func(o *subscriptionOptions) error { return o.setReplyAddr(v) }
+}
+
+func (o *subscriptionOptions) setReplyAddr(v string) error {
+	if _, err := compileAddressPattern(v); err != nil {
+		return fmt.Errorf("invalid reply address %q: %w", v, err)
+	}
+	o.replyAddr = v
+	return nil
+}
+
+// SubscriptionTimeout sets how long the device may stay silent before it is
+// considered dead. The default is three times the renewal interval.
+func SubscriptionTimeout(v time.Duration) func(*subscriptionOptions) error {
+	return func(o *subscriptionOptions) error { return o.setTimeout(v) }
+}
+
+func (o *subscriptionOptions) setTimeout(v time.Duration) error {
+	if v <= 0 {
+		return fmt.Errorf("timeout must be positive: %s", v)
+	}
+	o.timeout = v
+	return nil
+}
+
+// SubscriptionOnLiveness sets a function that is called whenever the device
+// becomes alive, because a reply arrived, or dead, because no reply arrived
+// within the timeout. A new Subscription starts out dead.
+func SubscriptionOnLiveness(v func(alive bool)) func(*subscriptionOptions) error {
+	return func(o *subscriptionOptions) error { return o.setOnLiveness(v) }
+}
+
+func (o *subscriptionOptions) setOnLiveness(v func(alive bool)) error {
+	o.onLiveness = v
+	return nil
+}
+
+// NewSubscription returns a Subscription that sends `pkt` through `client`
+// every `interval`. The client must be able to receive replies, see
+// Client.Handle.
+func NewSubscription(client *Client, pkt Packet, interval time.Duration, opts ...func(*subscriptionOptions) error) (*Subscription, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive: %s", interval)
+	}
+	o := &subscriptionOptions{timeout: 3 * interval}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return &Subscription{client: client, pkt: pkt, interval: interval, opts: o}, nil
+}
+
+// Run sends the subscription packet immediately and then every interval until
+// `ctx` is done, when it returns the context's error. Failures to send are not
+// fatal; they show as missing replies. Liveness is checked before every
+// renewal.
+func (s *Subscription) Run(ctx context.Context) error {
+	stop, err := s.client.watch(s.opts.replyAddr, func(*Message) bool {
+		s.replied(s.client.clock().Now())
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	s.mu.Lock()
+	s.lastReply = s.client.clock().Now() // Give the device a full timeout to reply.
+	s.mu.Unlock()
+
+	ticker := s.client.clock().NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.client.SendContext(ctx, s.pkt)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C():
+			s.check(now)
+		}
+	}
+}
+
+// Alive returns true if the device has replied within the timeout.
+func (s *Subscription) Alive() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.alive
+}
+
+// replied records a reply received at `now`.
+func (s *Subscription) replied(now time.Time) {
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	s.mu.Lock()
+	s.lastReply = now
+	changed := !s.alive
+	s.alive = true
+	s.mu.Unlock()
+	if changed {
+		s.notify(true)
+	}
+}
+
+// check marks the device as dead if it has not replied within the timeout.
+func (s *Subscription) check(now time.Time) {
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	s.mu.Lock()
+	changed := s.alive && now.Sub(s.lastReply) > s.opts.timeout
+	if changed {
+		s.alive = false
+	}
+	s.mu.Unlock()
+	if changed {
+		s.notify(false)
+	}
+}
+
+// notify reports a transition of the liveness. The caller must hold
+// s.notifyMu, so that transitions are reported one at a time and in order.
+func (s *Subscription) notify(alive bool) {
+	if s.opts.onLiveness != nil {
+		s.opts.onLiveness(alive)
+	}
+}
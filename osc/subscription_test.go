@@ -0,0 +1,132 @@
+package osc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubscription(t *testing.T) {
+	// The fake device answers /xremote until it is switched off.
+	var on atomic.Bool
+	on.Store(true)
+	device, err := NewServer("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := device.Handle("/xremote", func(msg *Message) {
+		if on.Load() {
+			msg.Reply(NewMessage("/info", "X32"))
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	client, err := Dial("udp", startServer(t, device))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	liveness := make(chan bool, 4)
+	sub, err := NewSubscription(client, NewMessage("/xremote"), 20*time.Millisecond,
+		SubscriptionReplyAddr("/info"),
+		SubscriptionTimeout(100*time.Millisecond),
+		SubscriptionOnLiveness(func(alive bool) { liveness <- alive }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- sub.Run(ctx) }()
+
+	for _, want := range []bool{true, false} {
+		select {
+		case got := <-liveness:
+			if got != want {
+				t.Fatalf("liveness = %t, want = %t", got, want)
+			}
+			if got := sub.Alive(); got != want {
+				t.Errorf("Alive() = %t, want = %t", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for liveness %t", want)
+		}
+		on.Store(false)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Run() = %v, want = %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after cancel")
+	}
+}
+
+func TestSubscriptionLivenessOrder(t *testing.T) {
+	var (
+		s           *Subscription
+		mu          sync.Mutex
+		transitions []bool
+	)
+	checked := make(chan struct{})
+	s, err := NewSubscription(&Client{}, NewMessage("/xremote"), time.Second,
+		SubscriptionOnLiveness(func(alive bool) {
+			if alive {
+				// The device dies while its revival is being reported.
+				go func() {
+					s.check(fakeClockStart.Add(time.Hour))
+					close(checked)
+				}()
+				select {
+				case <-checked:
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			transitions = append(transitions, alive)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.replied(fakeClockStart)
+	<-checked
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := transitions, []bool{true, false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("transitions = %v, want %v", got, want)
+	}
+}
+
+func TestNewSubscriptionError(t *testing.T) {
+	client := NewClient("localhost", 9000)
+	for _, tt := range []struct {
+		desc     string
+		interval time.Duration
+		opts     []func(*subscriptionOptions) error
+	}{
+		{"zero interval", 0, nil},
+		{"negative timeout", time.Second, []func(*subscriptionOptions) error{SubscriptionTimeout(-1)}},
+		{"invalid reply address", time.Second, []func(*subscriptionOptions) error{SubscriptionReplyAddr("/info/[")}},
+	} {
+		if _, err := NewSubscription(client, NewMessage("/xremote"), tt.interval, tt.opts...); err == nil {
+			t.Errorf("%s: NewSubscription() expected error", tt.desc)
+		}
+	}
+
+	sub, err := NewSubscription(client, NewMessage("/xremote"), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Run(context.Background()); err == nil {
+		t.Error("Run() on a client without socket expected error")
+	}
+}
@@ -0,0 +1,270 @@
+package osc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrSequencerClosed is returned by Sequencer.Schedule after a call to Close.
+var ErrSequencerClosed = errors.New("sequencer closed")
+
+// TempoMap converts musical time in beats to wall-clock time. It starts at
+// beat 0 at a reference time, and its tempo changes at given beats. Beat
+// positions are fractional, so beat 17.5 is the offbeat after beat 17. It is
+// safe for concurrent use.
+type TempoMap struct {
+	start time.Time // Time of beat 0.
+
+	mu      sync.RWMutex
+	changes []tempoChange // Sorted by beat; the first is at beat 0.
+}
+
+// tempoChange is a tempo that starts at a beat.
+type tempoChange struct {
+	beat   float64
+	bpm    float64
+	offset time.Duration // Time of the beat since the start of the map.
+}
+
+// NewTempoMap returns a TempoMap whose beat 0 is at the time `start`, with a
+// tempo of `bpm` beats per minute.
+func NewTempoMap(start time.Time, bpm float64) (*TempoMap, error) {
+	if err := checkTempo(bpm); err != nil {
+		return nil, err
+	}
+	return &TempoMap{start: start, changes: []tempoChange{{bpm: bpm}}}, nil
+}
+
+// SetTempo changes the tempo to `bpm` beats per minute from the beat `beat`
+// on, until the next tempo change. An existing change at the same beat is
+// replaced, and the times of all later beats move accordingly.
+func (m *TempoMap) SetTempo(beat, bpm float64) error {
+	if err := checkTempo(bpm); err != nil {
+		return err
+	}
+	if beat < 0 || math.IsInf(beat, 0) || math.IsNaN(beat) {
+		return fmt.Errorf("invalid beat: %g", beat)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := sort.Search(len(m.changes), func(i int) bool { return m.changes[i].beat >= beat })
+	if i < len(m.changes) && m.changes[i].beat == beat {
+		m.changes[i].bpm = bpm
+	} else {
+		m.changes = append(m.changes, tempoChange{})
+		copy(m.changes[i+1:], m.changes[i:])
+		m.changes[i] = tempoChange{beat: beat, bpm: bpm}
+	}
+	for j := max(i, 1); j < len(m.changes); j++ {
+		prev := m.changes[j-1]
+		m.changes[j].offset = prev.offset + beatsToDuration(m.changes[j].beat-prev.beat, prev.bpm)
+	}
+	return nil
+}
+
+// Tempo returns the tempo at the beat `beat` in beats per minute.
+func (m *TempoMap) Tempo(beat float64) float64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.changes[m.segment(beat)].bpm
+}
+
+// Time returns the time of the beat `beat`, rounded to the nanosecond. Beats
+// before beat 0 are at the initial tempo.
+func (m *TempoMap) Time(beat float64) time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := m.changes[m.segment(beat)]
+	return m.start.Add(c.offset + beatsToDuration(beat-c.beat, c.bpm))
+}
+
+// Timetag returns the time tag of the beat `beat`.
+func (m *TempoMap) Timetag(beat float64) Timetag {
+	return NewTimetag(m.Time(beat))
+}
+
+// Beat returns the beat position at the time `t`.
+func (m *TempoMap) Beat(t time.Time) float64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	d := t.Sub(m.start)
+	i := sort.Search(len(m.changes), func(i int) bool { return m.changes[i].offset > d }) - 1
+	c := m.changes[max(i, 0)]
+	return c.beat + (d-c.offset).Seconds()*c.bpm/60
+}
+
+// segment returns the index of the tempo change in effect at `beat`. The
+// caller must hold m.mu.
+func (m *TempoMap) segment(beat float64) int {
+	i := sort.Search(len(m.changes), func(i int) bool { return m.changes[i].beat > beat }) - 1
+	return max(i, 0)
+}
+
+// beatsToDuration returns the duration of `beats` beats at `bpm` beats per
+// minute.
+func beatsToDuration(beats, bpm float64) time.Duration {
+	return time.Duration(math.Round(beats * 60e9 / bpm))
+}
+
+func checkTempo(bpm float64) error {
+	if !(bpm > 0) || math.IsInf(bpm, 0) {
+		return fmt.Errorf("tempo must be positive: %g", bpm)
+	}
+	return nil
+}
+
+// Sequencer sends packets at beat positions of a TempoMap. The packets of a
+// beat are held until shortly before the beat, then sent as a bundle whose
+// time tag is the time of the beat, so that receivers that honour time tags
+// play them exactly on time. Tempo changes made with SetTempo move the
+// bundles that have not been sent yet.
+type Sequencer struct {
+	sender Sender
+	tempo  *TempoMap
+	opts   *sequencerOptions
+	sched  *scheduler
+
+	mu      sync.Mutex
+	pending map[*sequencedBundle]struct{}
+	closed  bool
+}
+
+// sequencedBundle are the packets held for a beat.
+type sequencedBundle struct {
+	beat float64
+	pkts []Packet
+	item *scheduledFunc
+}
+
+type sequencerOptions struct {
+	clock     Clock
+	lookahead time.Duration
+	onError   func(err error)
+}
+
+// SequencerClock sets the clock that bundles are released by. The default is
+// SystemClock.
+func SequencerClock(v Clock) func(*sequencerOptions) error {
+	return func(o *sequencerOptions) error { return o.setClock(v) }
+}
+
+func (o *sequencerOptions) setClock(v Clock) error {
+	if v == nil {
+		return errors.New("nil clock")
+	}
+	o.clock = v
+	return nil
+}
+
+// SequencerLookahead sets how long before its beat a bundle is sent, which
+// must cover the network latency and jitter. The default is 100ms.
+func SequencerLookahead(v time.Duration) func(*sequencerOptions) error {
+	return func(o *sequencerOptions) error { return o.setLookahead(v) }
+}
+
+func (o *sequencerOptions) setLookahead(v time.Duration) error {
+	if v < 0 {
+		return fmt.Errorf("negative lookahead: %s", v)
+	}
+	o.lookahead = v
+	return nil
+}
+
+// SequencerOnError sets a function that is called with the errors of bundles,
+// which are sent after Schedule has returned.
+func SequencerOnError(v func(err error)) func(*sequencerOptions) error {
+	return func(o *sequencerOptions) error { return o.setOnError(v) }
+}
+
+func (o *sequencerOptions) setOnError(v func(err error)) error {
+	o.onError = v
+	return nil
+}
+
+// NewSequencer returns a Sequencer that sends bundles through `s` at the
+// beats of `tempo`. The Sequencer does not take ownership of `s`.
+func NewSequencer(s Sender, tempo *TempoMap, opts ...func(*sequencerOptions) error) (*Sequencer, error) {
+	o := &sequencerOptions{clock: SystemClock, lookahead: 100 * time.Millisecond}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return &Sequencer{
+		sender:  s,
+		tempo:   tempo,
+		opts:    o,
+		sched:   newScheduler(o.clock),
+		pending: make(map[*sequencedBundle]struct{}),
+	}, nil
+}
+
+// Schedule sends the packets `pkts` in a bundle at the beat `beat`. Beats
+// that are closer than the lookahead, or have passed, are sent immediately.
+func (q *Sequencer) Schedule(beat float64, pkts ...Packet) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrSequencerClosed
+	}
+	b := &sequencedBundle{beat: beat, pkts: pkts}
+	q.pending[b] = struct{}{}
+	q.schedule(b)
+	return nil
+}
+
+// SetTempo changes the tempo of the TempoMap, see TempoMap.SetTempo, and
+// recomputes the time tags of the bundles that have not been sent yet.
+func (q *Sequencer) SetTempo(beat, bpm float64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.tempo.SetTempo(beat, bpm); err != nil {
+		return err
+	}
+	for b := range q.pending {
+		if q.sched.cancel(b.item) {
+			q.schedule(b)
+		}
+	}
+	return nil
+}
+
+// Close drops the bundles that have not been sent yet and stops the
+// Sequencer. Packets scheduled after Close are rejected with
+// ErrSequencerClosed.
+func (q *Sequencer) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.pending = nil
+	q.sched.clear()
+	return nil
+}
+
+// schedule releases `b` a lookahead before its beat. The caller must hold
+// q.mu.
+func (q *Sequencer) schedule(b *sequencedBundle) {
+	at := q.tempo.Time(b.beat).Add(-q.opts.lookahead)
+	b.item = q.sched.schedule(at, func() { q.send(b) })
+}
+
+// send sends the bundle of `b` with the current time of its beat.
+func (q *Sequencer) send(b *sequencedBundle) {
+	q.mu.Lock()
+	if _, ok := q.pending[b]; !ok {
+		q.mu.Unlock()
+		return // Dropped by Close.
+	}
+	delete(q.pending, b)
+	tt := q.tempo.Timetag(b.beat)
+	q.mu.Unlock()
+
+	if err := q.sender.Send(bundleOf(tt, b.pkts)); err != nil && q.opts.onError != nil {
+		q.opts.onError(err)
+	}
+}
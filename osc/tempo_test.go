@@ -0,0 +1,194 @@
+package osc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTempoMap(t *testing.T) {
+	m, err := NewTempoMap(fakeClockStart, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 120 bpm until beat 8, 60 bpm until beat 12, then 180 bpm.
+	if err := m.SetTempo(12, 180); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetTempo(8, 60); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		desc  string
+		beat  float64
+		since time.Duration
+		bpm   float64
+	}{
+		{"start", 0, 0, 120},
+		{"offbeat", 1.5, 750 * time.Millisecond, 120},
+		{"first change", 8, 4 * time.Second, 60},
+		{"after first change", 10, 6 * time.Second, 60},
+		{"second change", 12, 8 * time.Second, 180},
+		{"beat 17.5", 17.5, 9833333333, 180},
+		{"before start", -2, -time.Second, 120},
+	} {
+		if got, want := m.Time(tt.beat), fakeClockStart.Add(tt.since); !got.Equal(want) {
+			t.Errorf("%s: Time(%g) = %s, want %s", tt.desc, tt.beat, got, want)
+		}
+		if got, want := m.Timetag(tt.beat), NewTimetag(fakeClockStart.Add(tt.since)); got != want {
+			t.Errorf("%s: Timetag(%g) = %s, want %s", tt.desc, tt.beat, got, want)
+		}
+		if got, want := m.Tempo(tt.beat), tt.bpm; got != want {
+			t.Errorf("%s: Tempo(%g) = %g, want %g", tt.desc, tt.beat, got, want)
+		}
+		if got, want := m.Beat(fakeClockStart.Add(tt.since)), tt.beat; got < want-1e-6 || got > want+1e-6 {
+			t.Errorf("%s: Beat() = %g, want %g", tt.desc, got, want)
+		}
+	}
+
+	// Replacing a tempo change moves the later beats.
+	if err := m.SetTempo(8, 120); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Time(12), fakeClockStart.Add(6*time.Second); !got.Equal(want) {
+		t.Errorf("Time(12) = %s, want %s", got, want)
+	}
+}
+
+func TestTempoMapErrors(t *testing.T) {
+	if _, err := NewTempoMap(fakeClockStart, 0); err == nil {
+		t.Error("NewTempoMap() with zero tempo expected error")
+	}
+	m, err := NewTempoMap(fakeClockStart, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		desc      string
+		beat, bpm float64
+	}{
+		{"negative tempo", 4, -120},
+		{"negative beat", -1, 120},
+	} {
+		if err := m.SetTempo(tt.beat, tt.bpm); err == nil {
+			t.Errorf("%s: SetTempo(%g, %g) expected error", tt.desc, tt.beat, tt.bpm)
+		}
+	}
+}
+
+// chanSender passes the packets sent to it to a channel.
+type chanSender chan Packet
+
+func (s chanSender) Send(pkt Packet) error {
+	s <- pkt
+	return nil
+}
+
+func TestSequencer(t *testing.T) {
+	clock := NewFakeClock(fakeClockStart)
+	tempo, err := NewTempoMap(fakeClockStart, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := make(chanSender, 10)
+	q, err := NewSequencer(s, tempo, SequencerClock(clock), SequencerLookahead(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	receive := func() *Bundle {
+		select {
+		case pkt := <-s:
+			return pkt.(*Bundle)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no bundle sent")
+			return nil
+		}
+	}
+
+	if err := q.Schedule(2, NewMessage("/beat/2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Schedule(17.5, NewMessage("/beat/17.5"), NewMessage("/also/17.5")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Beat 2 at 120 bpm is sent at 0.9s with the time tag of 1s.
+	clock.BlockUntil(1)
+	clock.Advance(900 * time.Millisecond)
+	b := receive()
+	if got, want := b.Timetag, NewTimetag(fakeClockStart.Add(time.Second)); got != want {
+		t.Errorf("Timetag = %s, want %s", got, want)
+	}
+	if got, want := clock.Now(), fakeClockStart.Add(900*time.Millisecond); !got.Equal(want) {
+		t.Errorf("sent at %s, want %s", got, want)
+	}
+
+	// Halving the tempo from beat 4 moves beat 17.5 from 8.75s to 15.5s.
+	if err := q.SetTempo(4, 60); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(14 * time.Second)
+	select {
+	case pkt := <-s:
+		t.Fatalf("sent %v before the new time", pkt)
+	default:
+	}
+	clock.Advance(500 * time.Millisecond)
+	b = receive()
+	if got, want := b.Timetag, NewTimetag(fakeClockStart.Add(15500*time.Millisecond)); got != want {
+		t.Errorf("Timetag = %s, want %s", got, want)
+	}
+	if got, want := len(b.Messages), 2; got != want {
+		t.Errorf("bundle has %d messages, want %d", got, want)
+	}
+
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Schedule(20, NewMessage("/late")); err != ErrSequencerClosed {
+		t.Errorf("Schedule() error = %v, want %v", err, ErrSequencerClosed)
+	}
+}
+
+func TestSequencerOrder(t *testing.T) {
+	clock := NewFakeClock(fakeClockStart)
+	tempo, err := NewTempoMap(fakeClockStart, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := make(chanSender, 1)
+	q, err := NewSequencer(s, tempo, SequencerClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	nested := &Bundle{Timetag: Immediate}
+	nested.Append(NewMessage("/b"))
+	if err := q.Schedule(1, NewMessage("/a"), nested, NewMessage("/c")); err != nil {
+		t.Fatal(err)
+	}
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	var pkt Packet
+	select {
+	case pkt = <-s:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no bundle sent")
+	}
+
+	// A receiver dispatches the messages in the order they were scheduled.
+	var got []string
+	d := NewOSCDispatcher()
+	d.SetClock(clock)
+	for _, addr := range []string{"/a", "/b", "/c"} {
+		if err := d.AddMsgHandler(addr, func(msg *Message) { got = append(got, msg.Address) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Dispatch(pkt)
+	if want := []string{"/a", "/b", "/c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dispatched %v, want %v", got, want)
+	}
+}
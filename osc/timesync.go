@@ -0,0 +1,239 @@
+package osc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Time synchronization estimates the offset between the clock of a Client and
+// the clock of a Server with the four timestamps of NTP. The client sends
+//
+//	/timesync/request ,t <t1: client send time>
+//
+// and a Server with the ServerTimeSync option answers with
+//
+//	/timesync/reply ,ttt <t1> <t2: server receive time> <t3: server send time>
+//
+// which the client receives at t4. The offset of the server clock is
+// ((t2-t1)+(t3-t4))/2 and the round-trip delay is (t4-t1)-(t3-t2).
+const (
+	timeSyncRequestAddr = "/timesync/request"
+	timeSyncReplyAddr   = "/timesync/reply"
+)
+
+// TimeSample is an estimate of the offset of a remote clock.
+type TimeSample struct {
+	// Offset is the time to add to the local clock to get the remote time.
+	Offset time.Duration
+	// Delay is the round-trip delay of the exchange. The error of Offset is
+	// at most half of it.
+	Delay time.Duration
+}
+
+// TimeSync estimates the offset between the clock of a Client and the clock
+// of the Server it sends to, which must have the ServerTimeSync option. Like
+// NTP, it keeps the most recent samples and trusts the one with the lowest
+// round-trip delay, which is least affected by queueing.
+type TimeSync struct {
+	client *Client
+	opts   *timeSyncOptions
+
+	mu      sync.Mutex
+	samples []TimeSample // Most recent samples, oldest first.
+}
+
+type timeSyncOptions struct {
+	interval time.Duration
+	timeout  time.Duration
+	samples  int
+}
+
+// TimeSyncInterval sets how often Run samples the remote clock. The default
+// is one second.
+func TimeSyncInterval(v time.Duration) func(*timeSyncOptions) error {
+	return func(o *timeSyncOptions) error { return o.setInterval(v) }
+}
+
+func (o *timeSyncOptions) setInterval(v time.Duration) error {
+	if v <= 0 {
+		return fmt.Errorf("interval must be positive: %s", v)
+	}
+	o.interval = v
+	return nil
+}
+
+// TimeSyncTimeout sets how long Run waits for the reply to a sample. The
+// default is one second.
+func TimeSyncTimeout(v time.Duration) func(*timeSyncOptions) error {
+	return func(o *timeSyncOptions) error { return o.setTimeout(v) }
+}
+
+func (o *timeSyncOptions) setTimeout(v time.Duration) error {
+	if v <= 0 {
+		return fmt.Errorf("timeout must be positive: %s", v)
+	}
+	o.timeout = v
+	return nil
+}
+
+// TimeSyncSamples sets how many of the most recent samples are kept to choose
+// the estimate from. The default is 8, as in NTP.
+func TimeSyncSamples(v int) func(*timeSyncOptions) error {
+	return func(o *timeSyncOptions) error { return o.setSamples(v) }
+}
+
+func (o *timeSyncOptions) setSamples(v int) error {
+	if v < 1 {
+		return fmt.Errorf("samples must be at least 1: %d", v)
+	}
+	o.samples = v
+	return nil
+}
+
+// NewTimeSync returns a TimeSync that exchanges time stamps through `client`,
+// which must have been created with Dial to receive the replies. Times are
+// taken from the clock of the client, see ClientClock.
+func NewTimeSync(client *Client, opts ...func(*timeSyncOptions) error) (*TimeSync, error) {
+	o := &timeSyncOptions{interval: time.Second, timeout: time.Second, samples: 8}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return &TimeSync{client: client, opts: o}, nil
+}
+
+// Run samples the remote clock immediately and then every interval until
+// `ctx` is done, when it returns the context's error. Samples that fail or
+// time out are skipped.
+func (ts *TimeSync) Run(ctx context.Context) error {
+	ticker := ts.client.clock().NewTicker(ts.opts.interval)
+	defer ticker.Stop()
+	for {
+		sctx, cancel := context.WithTimeout(ctx, ts.opts.timeout)
+		ts.Sample(sctx)
+		cancel()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C():
+		}
+	}
+}
+
+// Sample exchanges time stamps with the server once, adds the result to the
+// samples and returns it. It waits for the reply until `ctx` is done.
+func (ts *TimeSync) Sample(ctx context.Context) (TimeSample, error) {
+	clock := ts.client.clock()
+	t1 := NewTimetag(clock.Now())
+	replies := make(chan TimeSample, 1)
+	stop, err := ts.client.watch(timeSyncReplyAddr, func(msg *Message) bool {
+		t4 := NewTimetag(clock.Now())
+		stamps, ok := timeSyncStamps(msg)
+		if !ok || len(stamps) != 3 {
+			return false // Malformed reply.
+		}
+		if stamps[0] != t1 {
+			return false // Reply to another request.
+		}
+		t2, t3 := stamps[1], stamps[2]
+		select {
+		case replies <- TimeSample{
+			Offset: (t2.Sub(t1) + t3.Sub(t4)) / 2,
+			Delay:  t4.Sub(t1) - t3.Sub(t2),
+		}:
+		default:
+		}
+		return true
+	})
+	if err != nil {
+		return TimeSample{}, err
+	}
+	defer stop()
+
+	if err := ts.client.SendContext(ctx, NewMessage(timeSyncRequestAddr, t1)); err != nil {
+		return TimeSample{}, err
+	}
+	select {
+	case s := <-replies:
+		ts.add(s)
+		return s, nil
+	case <-ctx.Done():
+		return TimeSample{}, ctx.Err()
+	}
+}
+
+// Estimate returns the sample with the lowest delay among the most recent
+// samples, and false if there are no samples yet.
+func (ts *TimeSync) Estimate() (TimeSample, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if len(ts.samples) == 0 {
+		return TimeSample{}, false
+	}
+	best := ts.samples[0]
+	for _, s := range ts.samples[1:] {
+		if s.Delay < best.Delay {
+			best = s
+		}
+	}
+	return best, true
+}
+
+// Clock returns a Clock that shows the time of the remote clock, as far as it
+// is known: the clock of the client corrected by the current estimate. It can
+// be given to ServerClock so that bundles are scheduled in the time of their
+// sender. Durations of timers and tickers are not corrected.
+func (ts *TimeSync) Clock() Clock {
+	return syncedClock{Clock: ts.client.clock(), ts: ts}
+}
+
+// add adds the sample `s`, dropping the oldest sample if there are too many.
+func (ts *TimeSync) add(s TimeSample) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.samples = append(ts.samples, s)
+	if n := len(ts.samples) - ts.opts.samples; n > 0 {
+		ts.samples = ts.samples[n:]
+	}
+}
+
+// syncedClock is a Clock corrected by the estimate of a TimeSync.
+type syncedClock struct {
+	Clock
+	ts *TimeSync
+}
+
+func (c syncedClock) Now() time.Time {
+	s, _ := c.ts.Estimate()
+	return c.Clock.Now().Add(s.Offset)
+}
+
+// timeSyncStamps returns the time tags of a time sync message.
+func timeSyncStamps(msg *Message) ([]Timetag, bool) {
+	stamps := make([]Timetag, len(msg.Arguments))
+	for i, arg := range msg.Arguments {
+		tt, ok := arg.(Timetag)
+		if !ok {
+			return nil, false
+		}
+		stamps[i] = tt
+	}
+	return stamps, len(stamps) > 0
+}
+
+// answerTimeSync replies to `msg` if it is a time sync request received at
+// `received`, with the send time taken from `clock`. It returns false if
+// `msg` is not a time sync request.
+func answerTimeSync(pkt Packet, received time.Time, clock Clock) bool {
+	msg, ok := pkt.(*Message)
+	if !ok || msg.Address != timeSyncRequestAddr {
+		return false
+	}
+	if stamps, ok := timeSyncStamps(msg); ok && len(stamps) == 1 {
+		msg.Reply(NewMessage(timeSyncReplyAddr, stamps[0], NewTimetag(received), NewTimetag(clock.Now())))
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package osc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimeSyncSample(t *testing.T) {
+	const offset = 40 * time.Millisecond
+	serverClock := NewFakeClock(fakeClockStart.Add(offset))
+	clientClock := NewFakeClock(fakeClockStart)
+	server, err := NewServer("", ServerTimeSync(true), ServerClock(serverClock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Dial("udp", startServer(t, server), ClientClock(clientClock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ts, err := NewTimeSync(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := ts.Estimate(); ok {
+		t.Error("Estimate() ok before the first sample")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s, err := ts.Sample(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fake clocks stand still during the exchange, so the estimate is
+	// exact.
+	if got, want := s, (TimeSample{Offset: offset}); got != want {
+		t.Errorf("Sample() = %+v, want %+v", got, want)
+	}
+	if got, want := ts.Clock().Now(), serverClock.Now(); !got.Equal(want) {
+		t.Errorf("Clock().Now() = %s, want %s", got, want)
+	}
+	clientClock.Advance(time.Second)
+	if got, want := ts.Clock().Now(), fakeClockStart.Add(time.Second+offset); !got.Equal(want) {
+		t.Errorf("Clock().Now() = %s, want %s", got, want)
+	}
+}
+
+func TestTimeSyncSampleUnsupported(t *testing.T) {
+	server, err := NewServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Dial("udp", startServer(t, server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ts, err := NewTimeSync(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := ts.Sample(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Sample() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestTimeSyncSampleMalformedReply(t *testing.T) {
+	server, err := NewServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.Handle(timeSyncRequestAddr, func(msg *Message) {
+		t1 := msg.Arguments[0]
+		msg.Reply(NewMessage(timeSyncReplyAddr, t1))
+		msg.Reply(NewMessage(timeSyncReplyAddr, t1, t1))
+		msg.Reply(NewMessage(timeSyncReplyAddr, t1, "x", int32(1)))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Dial("udp", startServer(t, server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ts, err := NewTimeSync(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The replies are ignored, and the client keeps running.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := ts.Sample(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Sample() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, ok := ts.Estimate(); ok {
+		t.Error("Estimate() ok after malformed replies")
+	}
+}
+
+func TestTimeSyncEstimate(t *testing.T) {
+	ms := time.Millisecond
+	for _, tt := range []struct {
+		desc    string
+		samples []TimeSample
+		want    TimeSample
+	}{
+		{"single", []TimeSample{{10 * ms, 4 * ms}}, TimeSample{10 * ms, 4 * ms}},
+		{"lowest delay",
+			[]TimeSample{{10 * ms, 30 * ms}, {2 * ms, 5 * ms}, {20 * ms, 50 * ms}},
+			TimeSample{2 * ms, 5 * ms}},
+		{"oldest dropped",
+			[]TimeSample{{1 * ms, 1 * ms}, {10 * ms, 30 * ms}, {2 * ms, 5 * ms}, {20 * ms, 50 * ms}},
+			TimeSample{2 * ms, 5 * ms}},
+	} {
+		ts, err := NewTimeSync(nil, TimeSyncSamples(3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range tt.samples {
+			ts.add(s)
+		}
+		got, ok := ts.Estimate()
+		if !ok {
+			t.Errorf("%s: Estimate() not ok", tt.desc)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Estimate() = %+v, want %+v", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestTimeSyncOptions(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		opt  func(*timeSyncOptions) error
+	}{
+		{"zero interval", TimeSyncInterval(0)},
+		{"negative timeout", TimeSyncTimeout(-time.Second)},
+		{"no samples", TimeSyncSamples(0)},
+	} {
+		if _, err := NewTimeSync(nil, tt.opt); err == nil {
+			t.Errorf("%s: expected an error", tt.desc)
+		}
+	}
+}
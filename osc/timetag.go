@@ -1,110 +1,161 @@
 package osc
 
-// Timetag represents an OSC Time Tag.
 import (
-	"bytes"
 	"encoding/binary"
 	"time"
 )
 
 const secondsFrom1900To1970 = 2208988800
 
-// An OSC Time Tag is defined as follows:
+// Timetag represents an OSC Time Tag. An OSC Time Tag is defined as follows:
 // Time tags are represented by a 64 bit fixed point number. The first 32 bits
 // specify the number of seconds since midnight on January 1, 1900, and the
 // last 32 bits specify fractional parts of a second to a precision of about
 // 200 picoseconds. This is the representation used by Internet NTP timestamps.
-type Timetag struct {
-	timeTag  uint64 // The acutal time tag
-	time     time.Time
-	MinValue uint64 // Minimum value of an OSC Time Tag. Is always 1.
+//
+// Timetag is a value type and can be compared with ==. As in NTP, the 32-bit
+// seconds wrap in February 2036; time tags whose most significant bit is zero
+// are taken to lie after the wrap, so times between 1968 and 2104 can be
+// represented.
+type Timetag uint64
+
+// Immediate is the special time tag that consists of 63 zero bits followed by
+// a one in the least significant bit, meaning "immediately".
+const Immediate Timetag = 1
+
+// NewTimetag returns the OSC time tag of the time `t`. The zero time.Time
+// returns Immediate.
+func NewTimetag(t time.Time) Timetag {
+	if t.IsZero() {
+		return Immediate
+	}
+	return Timetag(timeToTimetag(t))
 }
 
-// NewTimetag returns a new OSC time tag object.
-func NewTimetag(timeStamp time.Time) *Timetag {
-	return &Timetag{
-		time:     timeStamp,
-		timeTag:  timeToTimetag(timeStamp),
-		MinValue: uint64(1)}
+// NewTimetagFromTimetag returns the OSC time tag with the raw value `timetag`.
+func NewTimetagFromTimetag(timetag uint64) Timetag {
+	return Timetag(timetag)
 }
 
-// NewTimetagFromTimetag creates a new Timetag from the given `timetag`.
-func NewTimetagFromTimetag(timetag uint64) *Timetag {
-	time := timetagToTime(timetag)
-	return NewTimetag(time)
+// IsImmediate returns true if the time tag means "immediately". Like many OSC
+// implementations, the invalid value zero is also taken to mean
+// "immediately".
+func (t Timetag) IsImmediate() bool {
+	return t <= Immediate
 }
 
-// Time returns the time.
-func (t *Timetag) Time() time.Time {
-	return t.time
+// Time returns the time of the time tag, rounded to the nanosecond. It
+// returns the zero time.Time for Immediate.
+func (t Timetag) Time() time.Time {
+	if t.IsImmediate() {
+		return time.Time{}
+	}
+	return timetagToTime(uint64(t))
 }
 
 // FractionalSecond returns the last 32 bits of the OSC time tag. Specifies the
 // fractional part of a second.
-func (t *Timetag) FractionalSecond() uint32 {
-	return uint32(t.timeTag << 32)
+func (t Timetag) FractionalSecond() uint32 {
+	return uint32(t & 0xffffffff)
 }
 
 // SecondsSinceEpoch returns the first 32 bits (the number of seconds since the
 // midnight 1900) from the OSC time tag.
-func (t *Timetag) SecondsSinceEpoch() uint32 {
-	return uint32(t.timeTag >> 32)
+func (t Timetag) SecondsSinceEpoch() uint32 {
+	return uint32(t >> 32)
 }
 
 // TimeTag returns the time tag value
-func (t *Timetag) TimeTag() uint64 {
-	return t.timeTag
+func (t Timetag) TimeTag() uint64 {
+	return uint64(t)
 }
 
 // ToByteArray converts the OSC Time Tag to a byte array.
-func (t *Timetag) ToByteArray() []byte {
-	var data = new(bytes.Buffer)
-	if err := binary.Write(data, binary.BigEndian, t.timeTag); err != nil {
-		return []byte{}
-	}
-	return data.Bytes()
+func (t Timetag) ToByteArray() []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(t))
+}
+
+// Add returns the time tag `d` later than `t`.
+func (t Timetag) Add(d time.Duration) Timetag {
+	return t + Timetag(durationToFixed(d))
+}
+
+// Sub returns the duration t-u, rounded to the nanosecond. It assumes the two
+// time tags are less than 68 years apart.
+func (t Timetag) Sub(u Timetag) time.Duration {
+	return fixedToDuration(int64(t - u))
+}
+
+// Before returns true if `t` is earlier than `u`.
+func (t Timetag) Before(u Timetag) bool {
+	return int64(t-u) < 0
 }
 
-// SetTime sets the value of the OSC time tag.
-func (t *Timetag) SetTime(time time.Time) {
-	t.time = time
-	t.timeTag = timeToTimetag(time)
+// After returns true if `t` is later than `u`.
+func (t Timetag) After(u Timetag) bool {
+	return int64(t-u) > 0
+}
+
+// String implements the fmt.Stringer interface.
+func (t Timetag) String() string {
+	if t.IsImmediate() {
+		return "immediate"
+	}
+	return t.Time().UTC().Format(time.RFC3339Nano)
 }
 
 // ExpiresIn calculates the number of seconds until the current time is the
 // same as the value of the time tag. It returns zero if the value of the
 // time tag is in the past.
-func (t *Timetag) ExpiresIn() time.Duration {
-	if t.timeTag <= 1 {
+func (t Timetag) ExpiresIn() time.Duration {
+	return t.ExpiresInClock(SystemClock)
+}
+
+// ExpiresInClock is like ExpiresIn, but takes the current time from the clock
+// `c`.
+func (t Timetag) ExpiresInClock(c Clock) time.Duration {
+	if t.IsImmediate() {
 		return 0
 	}
+	if d := t.Time().Sub(c.Now()); d > 0 {
+		return d
+	}
+	return 0
+}
 
-	tt := timetagToTime(t.timeTag)
-	seconds := tt.Sub(time.Now())
+// timeToTimetag converts the given time to an OSC time tag, rounding the
+// nanoseconds to the nearest fraction of 2^-32 seconds.
+func timeToTimetag(t time.Time) uint64 {
+	seconds := uint64(t.Unix() + secondsFrom1900To1970)
+	fraction := (uint64(t.Nanosecond())<<32 + 5e8) / 1e9
+	return seconds<<32 + fraction // Wraps to NTP era 1 after 2036.
+}
 
-	if seconds <= 0 {
-		return 0
+// timetagToTime converts the given timetag to a time object, rounding the
+// fraction to the nearest nanosecond. Time tags with the most significant bit
+// clear are in NTP era 1, which starts in 2036.
+func timetagToTime(timetag uint64) time.Time {
+	seconds := int64(timetag >> 32)
+	if seconds&(1<<31) == 0 {
+		seconds += 1 << 32
 	}
-
-	return seconds
+	nanos := int64((timetag&0xffffffff*1e9 + 1<<31) >> 32)
+	return time.Unix(seconds-secondsFrom1900To1970, nanos)
 }
 
-// timeToTimetag converts the given time to an OSC time tag.
-//
-// An OSC time tag is defined as follows:
-// Time tags are represented by a 64 bit fixed point number. The first 32 bits
-// specify the number of seconds since midnight on January 1, 1900, and the
-// last 32 bits specify fractional parts of a second to a precision of about
-// 200 picoseconds. This is the representation used by Internet NTP timestamps.
-//
-// The time tag value consisting of 63 zero bits followed by a one in the least
-// significant bit is a special case meaning "immediately."
-func timeToTimetag(time time.Time) (timetag uint64) {
-	timetag = uint64((secondsFrom1900To1970 + time.Unix()) << 32)
-	return (timetag + uint64(uint32(time.Nanosecond())))
+// durationToFixed converts `d` to a signed 32.32 fixed point number of
+// seconds.
+func durationToFixed(d time.Duration) int64 {
+	seconds, nanos := int64(d/time.Second), int64(d%time.Second)
+	if nanos < 0 {
+		seconds, nanos = seconds-1, nanos+1e9
+	}
+	return seconds<<32 + (nanos<<32+5e8)/1e9
 }
 
-// timetagToTime converts the given timetag to a time object.
-func timetagToTime(timetag uint64) (t time.Time) {
-	return time.Unix(int64((timetag>>32)-secondsFrom1900To1970), int64(timetag&0xffffffff))
+// fixedToDuration converts the signed 32.32 fixed point number of seconds `f`
+// to a duration.
+func fixedToDuration(f int64) time.Duration {
+	seconds, fraction := f>>32, f&0xffffffff
+	return time.Duration(seconds)*time.Second + time.Duration((fraction*1e9+1<<31)>>32)
 }
@@ -0,0 +1,159 @@
+package osc
+
+import (
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// Times between these two can be represented as time tags.
+var (
+	minTimetagTime = time.Date(1968, 1, 20, 3, 14, 8, 0, time.UTC)
+	maxTimetagTime = time.Date(2104, 2, 26, 9, 42, 23, 0, time.UTC)
+)
+
+// timetagTime maps arbitrary numbers to a time that can be represented as a
+// time tag.
+func timetagTime(seconds int64, nanos uint32) time.Time {
+	span := maxTimetagTime.Unix() - minTimetagTime.Unix()
+	if seconds < 0 {
+		seconds = -(seconds + 1)
+	}
+	return time.Unix(minTimetagTime.Unix()+seconds%span, int64(nanos%1e9))
+}
+
+func TestTimetag(t *testing.T) {
+	for _, tt := range []struct {
+		desc     string
+		time     time.Time
+		timetag  Timetag
+		seconds  uint32
+		fraction uint32
+	}{
+		{"unix epoch", time.Unix(0, 0), 0x83aa7e80_00000000, 0x83aa7e80, 0},
+		{"half second", time.Unix(0, 5e8), 0x83aa7e80_80000000, 0x83aa7e80, 0x80000000},
+		{"nanosecond", time.Unix(0, 1), 0x83aa7e80_00000004, 0x83aa7e80, 4},
+		{"last nanosecond", time.Unix(0, 999999999), 0x83aa7e80_fffffffc, 0x83aa7e80, 0xfffffffc},
+		{"end of era 0", time.Date(2036, 2, 7, 6, 28, 15, 0, time.UTC), 0xffffffff_00000000, 0xffffffff, 0},
+		{"start of era 1", time.Date(2036, 2, 7, 6, 28, 17, 0, time.UTC), 0x00000001_00000000, 1, 0},
+	} {
+		got := NewTimetag(tt.time)
+		if got != tt.timetag {
+			t.Errorf("%s: NewTimetag() = %#x, want = %#x", tt.desc, uint64(got), uint64(tt.timetag))
+		}
+		if !got.Time().Equal(tt.time) {
+			t.Errorf("%s: Time() = %s, want = %s", tt.desc, got.Time(), tt.time)
+		}
+		if got, want := got.SecondsSinceEpoch(), tt.seconds; got != want {
+			t.Errorf("%s: SecondsSinceEpoch() = %#x, want = %#x", tt.desc, got, want)
+		}
+		if got, want := got.FractionalSecond(), tt.fraction; got != want {
+			t.Errorf("%s: FractionalSecond() = %#x, want = %#x", tt.desc, got, want)
+		}
+	}
+}
+
+func TestTimetagImmediate(t *testing.T) {
+	if got, want := NewTimetag(time.Time{}), Immediate; got != want {
+		t.Errorf("NewTimetag(zero time) = %v, want = %v", got, want)
+	}
+	for _, tt := range []Timetag{0, Immediate} {
+		if !tt.IsImmediate() {
+			t.Errorf("%#x: IsImmediate() = false, want = true", uint64(tt))
+		}
+		if !tt.Time().IsZero() {
+			t.Errorf("%#x: Time() = %s, want zero time", uint64(tt), tt.Time())
+		}
+		if got, want := tt.ExpiresIn(), time.Duration(0); got != want {
+			t.Errorf("%#x: ExpiresIn() = %s, want = %s", uint64(tt), got, want)
+		}
+	}
+	if got, want := Immediate.String(), "immediate"; got != want {
+		t.Errorf("String() = %s, want = %s", got, want)
+	}
+}
+
+func TestTimetagTimeRoundTrip(t *testing.T) {
+	// Time tags are more precise than nanoseconds, so times survive exactly.
+	f := func(seconds int64, nanos uint32) bool {
+		tm := timetagTime(seconds, nanos)
+		return NewTimetag(tm).Time().Equal(tm)
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTimetagValueRoundTrip(t *testing.T) {
+	// Converting to a time rounds to the nanosecond, which is less than five
+	// fractions of 2^-32 seconds.
+	f := func(v uint64) bool {
+		tt := Timetag(v)
+		if tt.IsImmediate() {
+			return true
+		}
+		d := int64(NewTimetag(tt.Time()) - tt)
+		return d >= -3 && d <= 3
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTimetagArithmetic(t *testing.T) {
+	f := func(seconds int64, nanos uint32, d time.Duration) bool {
+		d %= 50 * 365 * 24 * time.Hour // Stay within 68 years.
+		tt := NewTimetag(timetagTime(seconds, nanos))
+		later := tt.Add(d)
+		if later.Sub(tt) != d || later.After(tt) != (d > 0) || later.Before(tt) != (d < 0) {
+			return false
+		}
+		want := tt.Time().Add(d)
+		if want.Before(minTimetagTime) || want.After(maxTimetagTime) {
+			return true // Not representable as a time.
+		}
+		return later.Time().Equal(want)
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+
+	// Arithmetic and comparisons work across the end of NTP era 0.
+	before := NewTimetag(time.Date(2036, 2, 7, 6, 28, 15, 0, time.UTC))
+	after := before.Add(2 * time.Second)
+	if got, want := after.SecondsSinceEpoch(), uint32(1); got != want {
+		t.Errorf("SecondsSinceEpoch() = %d, want = %d", got, want)
+	}
+	if !before.Before(after) || !after.After(before) {
+		t.Errorf("%v is not before %v", before, after)
+	}
+	if got, want := after.Sub(before), 2*time.Second; got != want {
+		t.Errorf("Sub() = %s, want = %s", got, want)
+	}
+}
+
+func TestTimetagArgument(t *testing.T) {
+	tt := NewTimetag(time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.UTC))
+	data, err := NewMessage("/cue", tt).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkt, err := decodePacket(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pkt.(*Message).Arguments[0]; got != tt {
+		t.Errorf("decoded argument = %v, want = %v", got, tt)
+	}
+
+	data, err = (&Bundle{Timetag: tt}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkt, err = decodePacket(data); err != nil {
+		t.Fatal(err)
+	}
+	if got := pkt.(*Bundle).Timetag; got != tt {
+		t.Errorf("decoded bundle timetag = %v, want = %v", got, tt)
+	}
+}
@@ -0,0 +1,148 @@
+package osc
+
+import (
+	"context"
+	"log/slog"
+)
+
+// TraceAddress is the OSC address of the message that carries the trace
+// context of a packet between peers, see WithTraceContext.
+const TraceAddress = "/trace"
+
+// Tracer creates spans for the flow of packets through clients, servers,
+// dispatchers and handlers, so that a tracing system such as OpenTelemetry
+// can show where the time goes. The package does not depend on a tracing
+// system; an adapter implements Tracer on top of one. Implementations must be
+// safe for concurrent use.
+//
+// The spans are named "osc.send" for sending with a Client, including through
+// a MultiClient or Batcher, "osc.receive" for decoding a received packet,
+// "osc.dispatch" for matching a message against the handlers, and
+// "osc.handle" for each handler called.
+type Tracer interface {
+	// Start starts the span `name` as a child of the span in `ctx`, if any,
+	// and returns a context holding the new span.
+	Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// End ends the span. `err` is the error of the traced operation, or nil.
+	End(err error)
+}
+
+// TracePropagator is implemented by Tracers that link spans across peers.
+// Clients with such a Tracer send packets with the trace context of the
+// sending span, see WithTraceContext, and servers and clients with such a
+// Tracer continue the trace of the packets they receive.
+type TracePropagator interface {
+	// Inject returns the trace context of the span in `ctx`, for example a
+	// W3C traceparent, or "" if there is none.
+	Inject(ctx context.Context) string
+	// Extract returns a copy of `ctx` holding the remote trace context `tc`.
+	Extract(ctx context.Context, tc string) context.Context
+}
+
+// nopTracer is the default Tracer, which records nothing.
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, _ string, _ ...slog.Attr) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) End(error) {}
+
+// WithTraceContext returns a bundle that carries the packet `pkt` with the
+// trace context `tc`. The bundle's time tag is Immediate, its first message
+// is a TraceAddress message with `tc` as its only argument, and its only
+// other element is `pkt`, whose time tag is kept if it is a bundle. Servers
+// and clients with a Tracer unwrap such bundles, see SplitTraceContext; others,
+// like peers that do not know the convention, dispatch `pkt` as usual and drop
+// the TraceAddress message for want of a handler.
+func WithTraceContext(pkt Packet, tc string) *Bundle {
+	b := &Bundle{Timetag: Immediate, Messages: []*Message{NewMessage(TraceAddress, tc)}}
+	switch t := pkt.(type) {
+	case *Message:
+		b.Messages = append(b.Messages, t)
+	case *Bundle:
+		b.Bundles = append(b.Bundles, t)
+	}
+	return b
+}
+
+// withTraceContextData is WithTraceContext for the encoded packet `data`.
+func withTraceContextData(data []byte, tc string) []byte {
+	header, err := NewMessage(TraceAddress, tc).MarshalBinary()
+	if err != nil {
+		return data
+	}
+	return encodeBundle(Immediate, [][]byte{header, data})
+}
+
+// SplitTraceContext returns the packet carried by the bundle `pkt` and its
+// trace context, if `pkt` was made by WithTraceContext. Otherwise, it returns
+// `pkt` and "".
+func SplitTraceContext(pkt Packet) (Packet, string) {
+	b, ok := pkt.(*Bundle)
+	if !ok || !b.Timetag.IsImmediate() || len(b.Messages) == 0 || len(b.Messages)+len(b.Bundles) != 2 {
+		return pkt, ""
+	}
+	header := b.Messages[0]
+	if header.Address != TraceAddress || len(header.Arguments) != 1 {
+		return pkt, ""
+	}
+	tc, ok := header.Arguments[0].(string)
+	if !ok {
+		return pkt, ""
+	}
+	if len(b.Messages) == 2 {
+		return b.Messages[1], tc
+	}
+	return b.Bundles[0], tc
+}
+
+// traceSendAttrs returns the attributes of the span of sending `pkt` to
+// `dest`.
+func traceSendAttrs(dest string, pkt Packet) []slog.Attr {
+	attrs := []slog.Attr{slog.String("destination", dest)}
+	if msg, ok := pkt.(*Message); ok {
+		attrs = append(attrs, slog.String("address", msg.Address))
+	}
+	return attrs
+}
+
+// traceReceived unwraps the received packet `pkt` of `size` bytes, see
+// SplitTraceContext, and records the span of receiving it, continuing the
+// trace of the sender. The messages of the returned packet are handled within
+// that span. Without a Tracer, `pkt` is returned as it is.
+func traceReceived(t Tracer, pkt Packet, size int) Packet {
+	if _, ok := t.(nopTracer); ok {
+		return pkt
+	}
+	pkt, tc := SplitTraceContext(pkt)
+	ctx := context.Background()
+	if p, ok := t.(TracePropagator); ok && tc != "" {
+		ctx = p.Extract(ctx, tc)
+	}
+	ctx, span := t.Start(ctx, "osc.receive", slog.String("source", pkt.Addr()), slog.Int("size", size))
+	span.End(nil)
+	setContext(pkt, ctx)
+	return pkt
+}
+
+// setContext records the context `ctx` of a received packet in its messages.
+func setContext(pkt Packet, ctx context.Context) {
+	switch t := pkt.(type) {
+	case *Message:
+		t.ctx = ctx
+	case *Bundle:
+		for _, m := range t.Messages {
+			setContext(m, ctx)
+		}
+		for _, b := range t.Bundles {
+			setContext(b, ctx)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package osc
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTraceContext(t *testing.T) {
+	at := NewTimetag(fakeClockStart)
+	bundle := &Bundle{Timetag: at}
+	bundle.Append(NewMessage("/scheduled"))
+	untraced := NewBundle(time.Time{})
+	untraced.Append(NewMessage(TraceAddress, "00-abc-01"))
+	untraced.Append(NewMessage("/a"))
+	untraced.Append(NewMessage("/b"))
+
+	for _, tt := range []struct {
+		desc string
+		pkt  Packet
+		addr string // Of the first message of the packet returned.
+		tc   string
+	}{
+		{"message", WithTraceContext(NewMessage("/fader", float32(0.5)), "00-abc-01"), "/fader", "00-abc-01"},
+		{"bundle", WithTraceContext(bundle, "00-def-01"), "/scheduled", "00-def-01"},
+		{"plain message", NewMessage("/fader"), "/fader", ""},
+		{"bundle with more elements", untraced, TraceAddress, ""},
+	} {
+		data, err := tt.pkt.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: MarshalBinary() unexpected error; %s", tt.desc, err)
+		}
+		pkt, err := ParsePacket(string(data))
+		if err != nil {
+			t.Fatalf("%s: ParsePacket() unexpected error; %s", tt.desc, err)
+		}
+		got, tc := SplitTraceContext(pkt)
+		if tc != tt.tc {
+			t.Errorf("%s: trace context = %q, want %q", tt.desc, tc, tt.tc)
+		}
+		var addr string
+		switch p := got.(type) {
+		case *Message:
+			addr = p.Address
+		case *Bundle:
+			addr = p.Messages[0].Address
+			if tt.desc == "bundle" && p.Timetag != at {
+				t.Errorf("%s: Timetag = %s, want %s", tt.desc, p.Timetag, at)
+			}
+		}
+		if addr != tt.addr {
+			t.Errorf("%s: address = %s, want %s", tt.desc, addr, tt.addr)
+		}
+	}
+}
+
+// recordedSpan is a span of a recordingTracer.
+type recordedSpan struct {
+	tracer *recordingTracer
+	name   string
+	id     int
+	parent int // 0 for a root span.
+	attrs  map[string]string
+	err    error
+}
+
+func (s *recordedSpan) End(err error) {
+	s.err = err
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.ended = append(s.tracer.ended, s)
+}
+
+// spanKey is the context key of the id of the current span.
+type spanKey struct{}
+
+// recordingTracer is a Tracer and TracePropagator that records the spans that
+// have ended. The trace context is the id of a span.
+type recordingTracer struct {
+	mu     sync.Mutex
+	lastID int
+	ended  []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+	t.mu.Lock()
+	t.lastID++
+	s := &recordedSpan{tracer: t, name: name, id: t.lastID, attrs: make(map[string]string)}
+	t.mu.Unlock()
+	s.parent, _ = ctx.Value(spanKey{}).(int)
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value.String()
+	}
+	return context.WithValue(ctx, spanKey{}, s.id), s
+}
+
+func (t *recordingTracer) Inject(ctx context.Context) string {
+	if id, ok := ctx.Value(spanKey{}).(int); ok {
+		return strconv.Itoa(id)
+	}
+	return ""
+}
+
+func (t *recordingTracer) Extract(ctx context.Context, tc string) context.Context {
+	id, err := strconv.Atoi(tc)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, id)
+}
+
+// wait waits for the span `name` to end and returns it.
+func (t *recordingTracer) wait(tb testing.TB, name string) *recordedSpan {
+	tb.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		t.mu.Lock()
+		for _, s := range t.ended {
+			if s.name == name {
+				t.mu.Unlock()
+				return s
+			}
+		}
+		t.mu.Unlock()
+	}
+	tb.Fatalf("span %s not ended", name)
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	tracer := &recordingTracer{}
+	server, err := NewServer("", ServerTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handled := make(chan int, 1)
+	err = server.Handle("/fader", func(msg *Message) {
+		id, _ := msg.Context().Value(spanKey{}).(int)
+		handled <- id
+		panic("boom")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Dial("udp", startServer(t, server), ClientTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	if err := client.SendContext(ctx, NewMessage("/fader", float32(0.5))); err != nil {
+		t.Fatal(err)
+	}
+	root.End(nil)
+
+	// The trace continues from the client's span to the handler's.
+	send := tracer.wait(t, "osc.send")
+	receive := tracer.wait(t, "osc.receive")
+	dispatch := tracer.wait(t, "osc.dispatch")
+	handle := tracer.wait(t, "osc.handle")
+	for _, tt := range []struct {
+		span   *recordedSpan
+		parent int
+	}{
+		{send, root.(*recordedSpan).id},
+		{receive, send.id},
+		{dispatch, receive.id},
+		{handle, dispatch.id},
+	} {
+		if got, want := tt.span.parent, tt.parent; got != want {
+			t.Errorf("%s: parent = %d, want %d", tt.span.name, got, want)
+		}
+	}
+	if got, want := <-handled, handle.id; got != want {
+		t.Errorf("span in msg.Context() = %d, want %d", got, want)
+	}
+	if got, want := send.attrs["address"], "/fader"; got != want {
+		t.Errorf("osc.send: address = %q, want %q", got, want)
+	}
+	if receive.attrs["source"] == "" {
+		t.Error("osc.receive: no source")
+	}
+	if got, want := dispatch.attrs["handlers"], "1"; got != want {
+		t.Errorf("osc.dispatch: handlers = %q, want %q", got, want)
+	}
+	if handle.err == nil {
+		t.Error("osc.handle: no error for a panicking handler")
+	}
+	if send.err != nil {
+		t.Errorf("osc.send: unexpected error; %s", send.err)
+	}
+}
+
+func TestUntracedServer(t *testing.T) {
+	server, err := NewServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 2)
+	for _, addr := range []string{TraceAddress, "/fader"} {
+		if err := server.Handle(addr, func(msg *Message) { received <- msg.Address }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client, err := Dial("udp", startServer(t, server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Send(WithTraceContext(NewMessage("/fader"), "00-abc-01")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a Tracer, the bundle is dispatched as it is.
+	got := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case addr := <-received:
+			got[addr] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("dispatched %v, want %s and /fader", got, TraceAddress)
+		}
+	}
+}
+
+func TestTracingSharedMessage(t *testing.T) {
+	server, err := NewServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Handle("/info", func(msg *Message) { msg.Reply(NewMessage("/reply")) }); err != nil {
+		t.Fatal(err)
+	}
+	tracer := &recordingTracer{}
+	client, err := Dial("udp", startServer(t, server), ClientTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	handled := make(chan context.Context, 1)
+	if err := client.Handle("/reply", func(msg *Message) { handled <- msg.Context() }); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reply, err := client.Request(ctx, NewMessage("/info"), "/reply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The reply returned by Request is the message being dispatched, which
+	// must not change while the handler runs.
+	want := reply.Context()
+	hctx := <-handled
+	if got := reply.Context(); got != want {
+		t.Error("Context() of the reply changed during dispatch")
+	}
+	if id, _ := hctx.Value(spanKey{}).(int); id != tracer.wait(t, "osc.handle").id {
+		t.Errorf("handler span = %d, want the osc.handle span", id)
+	}
+}
+
+func TestTracingWrappers(t *testing.T) {
+	tracer := &recordingTracer{}
+	server, err := NewServer("", ServerTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handled := make(chan int, 1)
+	if err := server.Handle("/fader", func(msg *Message) {
+		id, _ := msg.Context().Value(spanKey{}).(int)
+		handled <- id
+	}); err != nil {
+		t.Fatal(err)
+	}
+	client, err := Dial("udp", startServer(t, server), ClientTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	m := NewMultiClient()
+	if err := m.Add("console", client); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	if err := m.SendContext(ctx, NewMessage("/fader", float32(0.5))); err != nil {
+		t.Fatal(err)
+	}
+	root.End(nil)
+
+	// Sending through a MultiClient continues the trace like Client.SendContext.
+	send := tracer.wait(t, "osc.send")
+	receive := tracer.wait(t, "osc.receive")
+	if got, want := send.parent, root.(*recordedSpan).id; got != want {
+		t.Errorf("osc.send: parent = %d, want %d", got, want)
+	}
+	if got, want := receive.parent, send.id; got != want {
+		t.Errorf("osc.receive: parent = %d, want %d", got, want)
+	}
+	select {
+	case id := <-handled:
+		if id == 0 {
+			t.Error("message handled without a span")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not dispatched")
+	}
+}
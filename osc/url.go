@@ -0,0 +1,166 @@
+package osc
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// URL is an OSC endpoint address in the URL form used by liblo and many other
+// OSC tools, for example:
+//
+//	osc.udp://localhost:9000/
+//	osc.tcp://[::1]:9000/
+//	osc.unix:///tmp/engine.sock
+//
+// The scheme selects the transport. As in liblo, osc.unix denotes unix
+// datagram sockets. Unix stream sockets, which liblo does not support, use
+// osc.unix.stream. Stream schemes accept a "framing" query parameter set to
+// "length-prefix" (the default) or "slip".
+type URL struct {
+	Scheme  string  // URL scheme, e.g. "osc.udp".
+	Network string  // Go network name, e.g. "udp" or "unixgram".
+	Addr    string  // Host and port, or the socket path for unix networks.
+	Path    string  // Path following the host and port, if any.
+	Framing Framing // Framing for stream networks.
+}
+
+// urlSchemes maps OSC URL schemes to Go network names.
+var urlSchemes = map[string]string{
+	"osc.udp":         "udp",
+	"osc.tcp":         "tcp",
+	"osc.unix":        "unixgram",
+	"osc.unix.stream": "unix",
+}
+
+// ParseURL parses an OSC URL such as osc.udp://localhost:9000/.
+func ParseURL(rawurl string) (*URL, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	network, ok := urlSchemes[strings.ToLower(u.Scheme)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported OSC URL scheme: %q", u.Scheme)
+	}
+	ou := &URL{Scheme: strings.ToLower(u.Scheme), Network: network}
+
+	if strings.HasPrefix(network, "unix") {
+		if u.Host != "" {
+			return nil, fmt.Errorf("unix OSC URL must not have a host: %q", rawurl)
+		}
+		if u.Path == "" {
+			return nil, fmt.Errorf("unix OSC URL has no socket path: %q", rawurl)
+		}
+		ou.Addr = u.Path
+	} else {
+		if u.Port() == "" {
+			return nil, fmt.Errorf("OSC URL has no port: %q", rawurl)
+		}
+		ou.Addr = net.JoinHostPort(u.Hostname(), u.Port())
+		ou.Path = u.Path
+	}
+
+	if v := u.Query().Get("framing"); v != "" {
+		if checkStreamNetwork(network) != nil {
+			return nil, fmt.Errorf("framing is only supported for stream transports: %q", rawurl)
+		}
+		switch v {
+		case FramingLengthPrefix.String():
+			ou.Framing = FramingLengthPrefix
+		case FramingSLIP.String():
+			ou.Framing = FramingSLIP
+		default:
+			return nil, fmt.Errorf("unsupported framing %q in OSC URL", v)
+		}
+	}
+	return ou, nil
+}
+
+// String implements the fmt.Stringer interface.
+func (u *URL) String() string {
+	s := u.Scheme + "://"
+	if strings.HasPrefix(u.Network, "unix") {
+		s += u.Addr
+	} else {
+		s += strings.ReplaceAll(u.Addr, "%", "%25") + u.Path // Zone of an IPv6 host.
+		if u.Path == "" {
+			s += "/"
+		}
+	}
+	if u.Framing != FramingLengthPrefix {
+		s += "?framing=" + u.Framing.String()
+	}
+	return s
+}
+
+// IsStream returns true if the URL denotes a stream transport.
+func (u *URL) IsStream() bool {
+	return checkStreamNetwork(u.Network) == nil
+}
+
+// SendCloser is the interface returned by DialURL. It is implemented by Client
+// and StreamClient.
+type SendCloser interface {
+	Sender
+	io.Closer
+}
+
+// DialURL returns a client that sends to the OSC URL `rawurl`. Datagram URLs
+// return a *Client created with Dial, stream URLs a connected *StreamClient.
+func DialURL(rawurl string, opts ...func(*clientOptions) error) (SendCloser, error) {
+	u, err := ParseURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.IsStream() {
+		opts = append([]func(*clientOptions) error{ClientFraming(u.Framing)}, opts...)
+		c, err := DialStream(u.Network, u.Addr, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	c, err := Dial(u.Network, u.Addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Receiver is the interface returned by ListenURL. It is implemented by
+// Server and StreamServer.
+type Receiver interface {
+	// Handle registers a message handler function for an OSC address.
+	Handle(addr string, handler HandlerFunc) error
+	// ListenAndServe listens on the server's address and serves it.
+	ListenAndServe() error
+	// Close stops the server.
+	Close() error
+}
+
+// ListenURL returns a server for the OSC URL `rawurl`. Datagram URLs return a
+// *Server, stream URLs a *StreamServer. The server starts listening when
+// ListenAndServe is called.
+func ListenURL(rawurl string, opts ...func(*serverOptions) error) (Receiver, error) {
+	u, err := ParseURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]func(*serverOptions) error{ServerNetwork(u.Network)}, opts...)
+	if u.IsStream() {
+		opts = append([]func(*serverOptions) error{ServerFraming(u.Framing)}, opts...)
+		s, err := NewStreamServer(u.Addr, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	s, err := NewServer(u.Addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
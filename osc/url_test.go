@@ -0,0 +1,127 @@
+package osc
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseURL(t *testing.T) {
+	for _, tt := range []struct {
+		desc    string
+		url     string
+		network string
+		addr    string
+		framing Framing
+		str     string
+		ok      bool
+	}{
+		{"udp", "osc.udp://localhost:9000/", "udp", "localhost:9000", FramingLengthPrefix, "osc.udp://localhost:9000/", true},
+		{"udp_no_slash", "osc.udp://127.0.0.1:9000", "udp", "127.0.0.1:9000", FramingLengthPrefix, "osc.udp://127.0.0.1:9000/", true},
+		{"udp_any_host", "osc.udp://:9000/", "udp", ":9000", FramingLengthPrefix, "osc.udp://:9000/", true},
+		{"udp_upper_scheme", "OSC.UDP://localhost:9000/", "udp", "localhost:9000", FramingLengthPrefix, "osc.udp://localhost:9000/", true},
+		{"ipv6", "osc.udp://[::1]:57120/", "udp", "[::1]:57120", FramingLengthPrefix, "osc.udp://[::1]:57120/", true},
+		{"ipv6_zone", "osc.udp://[fe80::1%25eth0]:9000/", "udp", "[fe80::1%eth0]:9000", FramingLengthPrefix, "osc.udp://[fe80::1%25eth0]:9000/", true},
+		{"tcp", "osc.tcp://host:3000/", "tcp", "host:3000", FramingLengthPrefix, "osc.tcp://host:3000/", true},
+		{"tcp_slip", "osc.tcp://host:3000/?framing=slip", "tcp", "host:3000", FramingSLIP, "osc.tcp://host:3000/?framing=slip", true},
+		{"unix", "osc.unix:///tmp/engine.sock", "unixgram", "/tmp/engine.sock", FramingLengthPrefix, "osc.unix:///tmp/engine.sock", true},
+		{"unix_stream", "osc.unix.stream:///tmp/ui.sock", "unix", "/tmp/ui.sock", FramingLengthPrefix, "osc.unix.stream:///tmp/ui.sock", true},
+		{"unknown_scheme", "http://localhost:9000/", "", "", 0, "", false},
+		{"no_port", "osc.udp://localhost/", "", "", 0, "", false},
+		{"unix_no_path", "osc.unix://", "", "", 0, "", false},
+		{"unix_host", "osc.unix://host/tmp/sock", "", "", 0, "", false},
+		{"udp_framing", "osc.udp://localhost:9000/?framing=slip", "", "", 0, "", false},
+		{"bad_framing", "osc.tcp://localhost:9000/?framing=cobs", "", "", 0, "", false},
+	} {
+		u, err := ParseURL(tt.url)
+		if err != nil && tt.ok {
+			t.Errorf("%s: ParseURL() unexpected error; %s", tt.desc, err)
+			continue
+		}
+		if err == nil && !tt.ok {
+			t.Errorf("%s: ParseURL() expected error", tt.desc)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if got, want := u.Network, tt.network; got != want {
+			t.Errorf("%s: Network = %s, want = %s", tt.desc, got, want)
+		}
+		if got, want := u.Addr, tt.addr; got != want {
+			t.Errorf("%s: Addr = %s, want = %s", tt.desc, got, want)
+		}
+		if got, want := u.Framing, tt.framing; got != want {
+			t.Errorf("%s: Framing = %s, want = %s", tt.desc, got, want)
+		}
+		if got, want := u.String(), tt.str; got != want {
+			t.Errorf("%s: String() = %s, want = %s", tt.desc, got, want)
+		}
+		// String() parses back to the same URL.
+		v, err := ParseURL(u.String())
+		if err != nil {
+			t.Errorf("%s: ParseURL(%s) unexpected error; %s", tt.desc, u, err)
+			continue
+		}
+		if v.Network != u.Network || v.Addr != u.Addr || v.Framing != u.Framing {
+			t.Errorf("%s: ParseURL(%s) = %+v, want = %+v", tt.desc, u, v, u)
+		}
+	}
+}
+
+func TestDialListenURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "osc.sock")
+	for _, tt := range []struct {
+		desc string
+		url  string
+	}{
+		{"unix", "osc.unix://" + path},
+		{"unix_stream_slip", "osc.unix.stream://" + path + "?framing=slip"},
+	} {
+		server, err := ListenURL(tt.url)
+		if err != nil {
+			t.Fatalf("%s: ListenURL() unexpected error; %s", tt.desc, err)
+		}
+		received := make(chan *Message, 1)
+		if err := server.Handle("/url", func(msg *Message) { received <- msg }); err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- server.ListenAndServe() }()
+		waitForFile(t, path)
+
+		client, err := DialURL(tt.url)
+		if err != nil {
+			t.Fatalf("%s: DialURL() unexpected error; %s", tt.desc, err)
+		}
+		if err := client.Send(NewMessage("/url", tt.desc)); err != nil {
+			t.Errorf("%s: Send() unexpected error; %s", tt.desc, err)
+		}
+		select {
+		case msg := <-received:
+			if got, want := msg.Arguments[0], tt.desc; got != want {
+				t.Errorf("%s: argument = %v, want = %v", tt.desc, got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s: timed out waiting for message", tt.desc)
+		}
+		client.Close()
+		server.Close()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: ListenAndServe() did not return after Close()", tt.desc)
+		}
+	}
+}
+
+func TestDialURLError(t *testing.T) {
+	// Nothing listens on the socket, so dialing the stream fails.
+	c, err := DialURL("osc.unix.stream://" + filepath.Join(t.TempDir(), "none.sock"))
+	if err == nil {
+		t.Fatal("DialURL() expected error")
+	}
+	if c != nil {
+		t.Errorf("DialURL() = %#v, want nil on error", c)
+	}
+}